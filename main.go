@@ -25,9 +25,13 @@ func main() {
 	})
 
 	root.AddCommand(cli.Defaults(cli.NewAuthServerCommand()))
+	root.AddCommand(cli.Defaults(cli.NewAdminCommand()))
+	root.AddCommand(cli.Defaults(cli.NewConfigCommand()))
+	root.AddCommand(cli.Defaults(cli.NewTokenCommand()))
+	root.AddCommand(cli.Defaults(cli.NewCheckCommand()))
 
 	if err := root.Execute(); err != nil {
-		log.Fatalf("error: %s\n", err)
-		os.Exit(int(cli.EX_FAIL))
+		log.Printf("error: %s\n", err)
+		os.Exit(int(cli.ExitCodeOf(err)))
 	}
 }
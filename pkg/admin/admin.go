@@ -0,0 +1,289 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+// ServiceName is the name of the admin gRPC service. Its messages are
+// well-known protobuf types, so no generated code is needed to call it.
+const ServiceName = "xquare.auth.admin.v1.Admin"
+
+// AdminServer manages the revocation state of the authentication server.
+// Times are given as RFC 3339 strings or Unix seconds.
+//
+// Changes are written to the revocations and not-before files, so that
+// every replica watching them applies the changes and they survive
+// restarts.
+type AdminServer interface {
+	// Revoke revokes the token id "jti" or the "subject" until
+	// "expires_at".
+	Revoke(context.Context, *structpb.Struct) (*emptypb.Empty, error)
+	// ListRevocations returns the revoked entries as a "revocations" list.
+	ListRevocations(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+	// SetNotBefore invalidates the tokens of "subject" issued before
+	// "not_before", which defaults to now.
+	SetNotBefore(context.Context, *structpb.Struct) (*emptypb.Empty, error)
+	// ListNotBefore returns the time set for each subject as a "subjects"
+	// object.
+	ListNotBefore(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+}
+
+type adminServer struct {
+	denylist  *jwt.Denylist
+	notBefore *jwt.NotBeforeStore
+}
+
+func NewAdminServer(denylist *jwt.Denylist, notBefore *jwt.NotBeforeStore) AdminServer {
+	return &adminServer{denylist: denylist, notBefore: notBefore}
+}
+
+func (s *adminServer) Revoke(ctx context.Context, in *structpb.Struct) (*emptypb.Empty, error) {
+	fields := in.GetFields()
+
+	revocation := jwt.Revocation{
+		ID:      fields["jti"].GetStringValue(),
+		Subject: fields["subject"].GetStringValue(),
+	}
+
+	expiresAt, err := parseTime(fields["expires_at"])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid expires_at: %s", err)
+	}
+	revocation.ExpiresAt = expiresAt
+
+	if err := revocation.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.denylist.Revoke(revocation); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"jti":        revocation.ID,
+		"subject":    revocation.Subject,
+		"expires_at": revocation.ExpiresAt,
+	}).Info("revoked token")
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *adminServer) ListRevocations(ctx context.Context, in *emptypb.Empty) (*structpb.Struct, error) {
+	var revocations []interface{}
+	for _, r := range s.denylist.List() {
+		entry := map[string]interface{}{}
+		if len(r.ID) != 0 {
+			entry["jti"] = r.ID
+		}
+		if len(r.Subject) != 0 {
+			entry["subject"] = r.Subject
+		}
+		if !r.ExpiresAt.IsZero() {
+			entry["expires_at"] = r.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		revocations = append(revocations, entry)
+	}
+
+	result, err := structpb.NewStruct(map[string]interface{}{"revocations": revocations})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return result, nil
+}
+
+func (s *adminServer) SetNotBefore(ctx context.Context, in *structpb.Struct) (*emptypb.Empty, error) {
+	fields := in.GetFields()
+	subject := fields["subject"].GetStringValue()
+
+	notBefore, err := parseTime(fields["not_before"])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid not_before: %s", err)
+	}
+	if notBefore.IsZero() {
+		notBefore = time.Now()
+	}
+
+	if len(subject) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "not-before needs a subject")
+	}
+	if err := s.notBefore.Set(subject, notBefore); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"subject":    subject,
+		"not_before": notBefore,
+	}).Info("invalidated tokens of subject")
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *adminServer) ListNotBefore(ctx context.Context, in *emptypb.Empty) (*structpb.Struct, error) {
+	subjects := map[string]interface{}{}
+	for subject, t := range s.notBefore.List() {
+		subjects[subject] = t.UTC().Format(time.RFC3339)
+	}
+
+	result, err := structpb.NewStruct(map[string]interface{}{"subjects": subjects})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return result, nil
+}
+
+func parseTime(v *structpb.Value) (time.Time, error) {
+	switch k := v.GetKind().(type) {
+	case nil, *structpb.Value_NullValue:
+		return time.Time{}, nil
+	case *structpb.Value_NumberValue:
+		return time.Unix(int64(k.NumberValue), 0), nil
+	case *structpb.Value_StringValue:
+		if len(k.StringValue) == 0 {
+			return time.Time{}, nil
+		}
+		return time.Parse(time.RFC3339, k.StringValue)
+	}
+
+	return time.Time{}, fmt.Errorf("expected a time, got %T", v.GetKind())
+}
+
+// AdminClient calls the admin service.
+type AdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) *AdminClient {
+	return &AdminClient{cc: cc}
+}
+
+func (c *AdminClient) Revoke(ctx context.Context, in *structpb.Struct, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	if err := c.cc.Invoke(ctx, "/"+ServiceName+"/Revoke", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *AdminClient) ListRevocations(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*structpb.Struct, error) {
+	out := new(structpb.Struct)
+	if err := c.cc.Invoke(ctx, "/"+ServiceName+"/ListRevocations", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *AdminClient) SetNotBefore(ctx context.Context, in *structpb.Struct, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	if err := c.cc.Invoke(ctx, "/"+ServiceName+"/SetNotBefore", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *AdminClient) ListNotBefore(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*structpb.Struct, error) {
+	out := new(structpb.Struct)
+	if err := c.cc.Invoke(ctx, "/"+ServiceName+"/ListNotBefore", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func RegisterAdminServer(srv *grpc.Server, s AdminServer) {
+	srv.RegisterService(&serviceDesc, s)
+}
+
+func revokeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Revoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/Revoke",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Revoke(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listRevocationsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListRevocations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/ListRevocations",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListRevocations(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func setNotBeforeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetNotBefore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/SetNotBefore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetNotBefore(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listNotBeforeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListNotBefore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/ListNotBefore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListNotBefore(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Revoke", Handler: revokeHandler},
+		{MethodName: "ListRevocations", Handler: listRevocationsHandler},
+		{MethodName: "SetNotBefore", Handler: setNotBeforeHandler},
+		{MethodName: "ListNotBefore", Handler: listNotBeforeHandler},
+	},
+	Streams: []grpc.StreamDesc{},
+}
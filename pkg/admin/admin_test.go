@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+func prepareAdminClient(t *testing.T, denylist *jwt.Denylist, notBefore *jwt.NotBeforeStore) *AdminClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	RegisterAdminServer(srv, NewAdminServer(denylist, notBefore))
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return NewAdminClient(conn)
+}
+
+func TestRevoke(t *testing.T) {
+	denylist := jwt.NewDenylist()
+	client := prepareAdminClient(t, denylist, jwt.NewNotBeforeStore())
+
+	request, err := structpb.NewStruct(map[string]interface{}{
+		"jti":        "leaked",
+		"expires_at": "2099-01-01T00:00:00Z",
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Revoke(context.Background(), request)
+	assert.NoError(t, err)
+
+	claims := &jwt.JWTClaims{}
+	claims.Id = "leaked"
+	assert.True(t, denylist.Revoked(claims))
+
+	result, err := client.ListRevocations(context.Background(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"revocations": []interface{}{
+			map[string]interface{}{"jti": "leaked", "expires_at": "2099-01-01T00:00:00Z"},
+		},
+	}, result.AsMap())
+}
+
+func TestRevokeReachesEveryReplica(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("[]"), 0o600))
+
+	denylist, err := jwt.LoadDenylist(path)
+	assert.NoError(t, err)
+	replica, err := jwt.LoadDenylist(path)
+	assert.NoError(t, err)
+
+	client := prepareAdminClient(t, denylist, jwt.NewNotBeforeStore())
+	request, err := structpb.NewStruct(map[string]interface{}{"jti": "leaked"})
+	assert.NoError(t, err)
+	_, err = client.Revoke(context.Background(), request)
+	assert.NoError(t, err)
+
+	claims := &jwt.JWTClaims{}
+	claims.Id = "leaked"
+	assert.NoError(t, replica.Reload())
+	assert.True(t, replica.Revoked(claims))
+}
+
+func TestRevokeInvalid(t *testing.T) {
+	client := prepareAdminClient(t, jwt.NewDenylist(), jwt.NewNotBeforeStore())
+
+	for _, fields := range []map[string]interface{}{
+		{},
+		{"jti": "leaked", "subject": "kimxwan0319"},
+		{"jti": "leaked", "expires_at": "tomorrow"},
+		{"jti": "leaked", "expires_at": true},
+	} {
+		request, err := structpb.NewStruct(fields)
+		assert.NoError(t, err)
+
+		_, err = client.Revoke(context.Background(), request)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), fields)
+	}
+}
+
+func TestSetNotBefore(t *testing.T) {
+	store := jwt.NewNotBeforeStore()
+	client := prepareAdminClient(t, jwt.NewDenylist(), store)
+
+	request, err := structpb.NewStruct(map[string]interface{}{
+		"subject":    "kimxwan0319",
+		"not_before": float64(1656666000),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.SetNotBefore(context.Background(), request)
+	assert.NoError(t, err)
+
+	result, err := client.ListNotBefore(context.Background(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"subjects": map[string]interface{}{"kimxwan0319": "2022-07-01T09:00:00Z"},
+	}, result.AsMap())
+
+	request, err = structpb.NewStruct(map[string]interface{}{"subject": "kimxwan0319"})
+	assert.NoError(t, err)
+
+	before := time.Now().Add(-time.Second)
+	_, err = client.SetNotBefore(context.Background(), request)
+	assert.NoError(t, err)
+
+	notBefore, ok := store.Get("kimxwan0319")
+	assert.True(t, ok)
+	assert.True(t, notBefore.After(before))
+
+	_, err = client.SetNotBefore(context.Background(), &structpb.Struct{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
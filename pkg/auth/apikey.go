@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/team-xquare/contour-middleware/pkg/errors"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+	"github.com/team-xquare/contour-middleware/pkg/watch"
+)
+
+const DefaultAPIKeyHeader = "X-Api-Key"
+
+// APIKey is an entry of the key store. Only the SHA-256 hash of the key is
+// stored, as "sha256:<hex>".
+type APIKey struct {
+	ID          string    `yaml:"id"`
+	Hash        string    `yaml:"hash"`
+	Role        string    `yaml:"role"`
+	Authorities []string  `yaml:"authorities"`
+	ExpiresAt   time.Time `yaml:"expiresAt"`
+}
+
+// APIKeyStore authenticates service-to-service callers by API key against
+// a YAML list of APIKey.
+type APIKeyStore struct {
+	path string
+
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+// HashAPIKey returns the store representation of key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func LoadAPIKeyStore(path string) (*APIKeyStore, error) {
+	s := &APIKeyStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload re-reads the key store.
+func (s *APIKeyStore) Reload() error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var entries []APIKey
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid API key store %s: %w", s.path, err)
+	}
+
+	keys := map[string]APIKey{}
+	ids := map[string]bool{}
+	for _, k := range entries {
+		if len(k.ID) == 0 {
+			return fmt.Errorf("invalid API key store %s: key without id", s.path)
+		}
+		if ids[k.ID] {
+			return fmt.Errorf("invalid API key store %s: duplicate id %q", s.path, k.ID)
+		}
+		if !strings.HasPrefix(k.Hash, "sha256:") || len(k.Hash) != len("sha256:")+sha256.Size*2 {
+			return fmt.Errorf("invalid API key store %s: key %q has no sha256 hash", s.path, k.ID)
+		}
+		ids[k.ID] = true
+		keys[strings.ToLower(k.Hash)] = k
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the key store whenever its file changes, until ctx is done.
+func (s *APIKeyStore) Watch(ctx context.Context, interval time.Duration) {
+	watch.Reload(ctx, interval, "API key store", s.Reload, s.path)
+}
+
+// Authenticate returns the identity of the caller owning key.
+func (s *APIKeyStore) Authenticate(key string) (*jwt.JWTClaims, error) {
+	s.mu.RLock()
+	entry, ok := s.keys[HashAPIKey(key)]
+	s.mu.RUnlock()
+
+	if !ok || (!entry.ExpiresAt.IsZero() && time.Now().After(entry.ExpiresAt)) {
+		return nil, errors.NewInvalidCredentialsError("API key")
+	}
+
+	claims := &jwt.JWTClaims{Role: entry.Role, Authorities: entry.Authorities}
+	claims.Subject = entry.ID
+	if !entry.ExpiresAt.IsZero() {
+		claims.ExpiresAt = entry.ExpiresAt.Unix()
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/team-xquare/contour-middleware/pkg/errors"
+)
+
+func prepareAPIKeyStore(t *testing.T) *APIKeyStore {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "api-keys.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(fmt.Sprintf(`
+- id: batch-worker
+  hash: %s
+  role: SYSTEM
+  authorities: [FEED_READ]
+- id: retired-worker
+  hash: %s
+  role: SYSTEM
+  expiresAt: %s
+`,
+		HashAPIKey("batch-key"),
+		HashAPIKey("retired-key"),
+		time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+	)), 0600))
+
+	store, err := LoadAPIKeyStore(path)
+	assert.NoError(t, err)
+
+	return store
+}
+
+func TestAPIKeyStoreAuthenticate(t *testing.T) {
+	store := prepareAPIKeyStore(t)
+
+	claims, err := store.Authenticate("batch-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "batch-worker", claims.Subject)
+	assert.Equal(t, "SYSTEM", claims.Role)
+	assert.Equal(t, []string{"FEED_READ"}, claims.Authorities)
+
+	_, err = store.Authenticate("retired-key")
+	assert.IsType(t, errors.InvalidCredentialsError{}, err)
+
+	_, err = store.Authenticate("unknown-key")
+	assert.IsType(t, errors.InvalidCredentialsError{}, err)
+}
+
+func TestInvalidAPIKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-keys.yaml")
+
+	for _, content := range []string{
+		`[{id: a, hash: "plain"}]`,
+		`[{hash: "` + HashAPIKey("k") + `"}]`,
+		`[{id: a, hash: "` + HashAPIKey("k") + `"}, {id: a, hash: "` + HashAPIKey("l") + `"}]`,
+	} {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		_, err := LoadAPIKeyStore(path)
+		assert.Error(t, err, content)
+	}
+}
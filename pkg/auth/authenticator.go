@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/team-xquare/contour-middleware/pkg/errors"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+// Authenticator identifies the caller of a request from one kind of
+// credentials. It returns errors.ErrNoCredentials when the request carries
+// none of the credentials it understands, so the next one can be tried.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, request *Request) (*jwt.JWTClaims, error)
+}
+
+// TokenVerifier verifies a JWT token found in request.
+type TokenVerifier func(token string, request *Request) (*jwt.JWTClaims, error)
+
+type AuthenticatorType string
+
+const (
+	AuthenticatorCookie AuthenticatorType = "cookie"
+	AuthenticatorBearer AuthenticatorType = "bearer"
+	AuthenticatorAPIKey AuthenticatorType = "api-key"
+	AuthenticatorMTLS   AuthenticatorType = "mtls"
+	AuthenticatorBasic  AuthenticatorType = "basic"
+)
+
+func ParseAuthenticatorType(s string) (AuthenticatorType, error) {
+	switch t := AuthenticatorType(s); t {
+	case AuthenticatorCookie, AuthenticatorBearer, AuthenticatorAPIKey, AuthenticatorMTLS, AuthenticatorBasic:
+		return t, nil
+	}
+
+	return "", fmt.Errorf("unknown authenticator %q", s)
+}
+
+type ChainMode string
+
+const (
+	// ChainFirstMatch lets the first authenticator that finds credentials
+	// decide.
+	ChainFirstMatch ChainMode = "first-match"
+	// ChainAllMustPass requires every authenticator to find valid
+	// credentials; the identity is taken from the first one.
+	ChainAllMustPass ChainMode = "all-must-pass"
+)
+
+func ParseChainMode(s string) (ChainMode, error) {
+	switch mode := ChainMode(s); mode {
+	case ChainFirstMatch, ChainAllMustPass:
+		return mode, nil
+	}
+
+	return "", fmt.Errorf("invalid authenticator chain mode %q", s)
+}
+
+// Chain runs authenticators in order.
+type Chain struct {
+	Mode           ChainMode
+	Authenticators []Authenticator
+}
+
+// Authenticate returns the identity of the caller along with the name of
+// the authenticator that established it. errors.ErrNoCredentials is
+// returned when no authenticator found any credentials.
+func (c *Chain) Authenticate(ctx context.Context, request *Request) (*jwt.JWTClaims, string, error) {
+	var claims *jwt.JWTClaims
+	var decidedBy string
+	var missing []string
+
+	for _, a := range c.Authenticators {
+		result, err := a.Authenticate(ctx, request)
+		if err == errors.ErrNoCredentials {
+			missing = append(missing, a.Name())
+			continue
+		}
+		if err != nil {
+			return nil, a.Name(), err
+		}
+
+		if claims == nil {
+			claims, decidedBy = result, a.Name()
+		}
+		if c.Mode != ChainAllMustPass {
+			break
+		}
+	}
+
+	if claims == nil {
+		return nil, "", errors.ErrNoCredentials
+	}
+	if c.Mode == ChainAllMustPass && len(missing) != 0 {
+		return nil, missing[0], errors.NewUnauthenticatedError("missing credentials for " + strings.Join(missing, ", "))
+	}
+
+	return claims, decidedBy, nil
+}
+
+type cookieAuthenticator struct {
+	cookie string
+	verify TokenVerifier
+}
+
+// NewCookieAuthenticator verifies the JWT token stored in the named cookie.
+func NewCookieAuthenticator(cookie string, verify TokenVerifier) Authenticator {
+	return &cookieAuthenticator{cookie: cookie, verify: verify}
+}
+
+func (a *cookieAuthenticator) Name() string {
+	return string(AuthenticatorCookie)
+}
+
+func (a *cookieAuthenticator) Authenticate(ctx context.Context, request *Request) (*jwt.JWTClaims, error) {
+	cookie, err := request.Request.Cookie(a.cookie)
+	if err != nil || cookie == nil || len(cookie.Value) == 0 {
+		return nil, errors.ErrNoCredentials
+	}
+
+	return a.verify(cookie.Value, request)
+}
+
+type bearerAuthenticator struct {
+	verify TokenVerifier
+}
+
+// NewBearerAuthenticator verifies the JWT token of a Bearer Authorization
+// header.
+func NewBearerAuthenticator(verify TokenVerifier) Authenticator {
+	return &bearerAuthenticator{verify: verify}
+}
+
+func (a *bearerAuthenticator) Name() string {
+	return string(AuthenticatorBearer)
+}
+
+func (a *bearerAuthenticator) Authenticate(ctx context.Context, request *Request) (*jwt.JWTClaims, error) {
+	tokenType, token := getTokenInfo(request)
+	if !strings.EqualFold(tokenType, "bearer") || len(token) == 0 {
+		return nil, errors.ErrNoCredentials
+	}
+
+	return a.verify(token, request)
+}
+
+type apiKeyAuthenticator struct {
+	store  *APIKeyStore
+	header string
+	query  string
+}
+
+// NewAPIKeyAuthenticator looks up the API key read from header, or from the
+// query parameter when the header is absent, in store. An empty query
+// disables the query parameter.
+func NewAPIKeyAuthenticator(store *APIKeyStore, header string, query string) Authenticator {
+	return &apiKeyAuthenticator{store: store, header: header, query: query}
+}
+
+func (a *apiKeyAuthenticator) Name() string {
+	return string(AuthenticatorAPIKey)
+}
+
+func (a *apiKeyAuthenticator) Authenticate(ctx context.Context, request *Request) (*jwt.JWTClaims, error) {
+	key := request.Request.Header.Get(a.header)
+	if len(key) == 0 && len(a.query) != 0 && request.Request.URL != nil {
+		key = request.Request.URL.Query().Get(a.query)
+	}
+	if len(key) == 0 {
+		return nil, errors.ErrNoCredentials
+	}
+
+	return a.store.Authenticate(key)
+}
+
+type basicAuthenticator struct {
+	htpasswd *HTPasswd
+}
+
+// NewBasicAuthenticator verifies HTTP Basic credentials against htpasswd.
+func NewBasicAuthenticator(htpasswd *HTPasswd) Authenticator {
+	return &basicAuthenticator{htpasswd: htpasswd}
+}
+
+func (a *basicAuthenticator) Name() string {
+	return string(AuthenticatorBasic)
+}
+
+func (a *basicAuthenticator) Authenticate(ctx context.Context, request *Request) (*jwt.JWTClaims, error) {
+	tokenType, _ := getTokenInfo(request)
+	if !strings.EqualFold(tokenType, "basic") {
+		return nil, errors.ErrNoCredentials
+	}
+
+	username, password, ok := request.Request.BasicAuth()
+	if !ok {
+		return nil, errors.NewInvalidCredentialsError("basic")
+	}
+
+	return a.htpasswd.Authenticate(username, password)
+}
+
+type mtlsAuthenticator struct {
+	role        string
+	authorities []string
+}
+
+// NewMTLSAuthenticator identifies callers by the principal of the client
+// certificate Envoy verified on the downstream connection, giving them the
+// role and authorities.
+func NewMTLSAuthenticator(role string, authorities []string) Authenticator {
+	return &mtlsAuthenticator{role: role, authorities: authorities}
+}
+
+func (a *mtlsAuthenticator) Name() string {
+	return string(AuthenticatorMTLS)
+}
+
+func (a *mtlsAuthenticator) Authenticate(ctx context.Context, request *Request) (*jwt.JWTClaims, error) {
+	if len(request.Principal) == 0 {
+		return nil, errors.ErrNoCredentials
+	}
+
+	claims := &jwt.JWTClaims{Role: a.role, Authorities: a.authorities}
+	claims.Subject = request.Principal
+
+	return claims, nil
+}
+
+func getTokenInfo(request *Request) (string, string) {
+	token := request.Request.Header.Get("Authorization")
+	splittedToken := strings.Split(token, " ")
+	if len(splittedToken) != 2 {
+		return "", ""
+	}
+	return splittedToken[0], splittedToken[1]
+}
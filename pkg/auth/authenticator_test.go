@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/team-xquare/contour-middleware/pkg/errors"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+func prepareRequest(header http.Header) *Request {
+	return &Request{
+		ID: "100",
+		Request: http.Request{
+			Header: header,
+			Method: "GET",
+			Proto:  "HTTP/1.1",
+			URL: &url.URL{
+				Scheme: "https",
+				Host:   "example.com",
+				Path:   "example",
+			},
+		},
+	}
+}
+
+// verifyAsSubject accepts every token but "invalid", using it as the subject.
+func verifyAsSubject(token string, request *Request) (*jwt.JWTClaims, error) {
+	if token == "invalid" {
+		return nil, &jwt.ValidationError{Errors: jwt.ValidationErrorKeyNotFound}
+	}
+
+	claims := &jwt.JWTClaims{}
+	claims.Subject = token
+	return claims, nil
+}
+
+func TestCookieAuthenticator(t *testing.T) {
+	a := NewCookieAuthenticator("accessToken", verifyAsSubject)
+
+	claims, err := a.Authenticate(context.Background(), prepareRequest(http.Header{"Cookie": {"accessToken=user"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, "user", claims.Subject)
+
+	_, err = a.Authenticate(context.Background(), prepareRequest(http.Header{"Cookie": {"other=user"}}))
+	assert.Equal(t, errors.ErrNoCredentials, err)
+}
+
+func TestBearerAuthenticator(t *testing.T) {
+	a := NewBearerAuthenticator(verifyAsSubject)
+
+	claims, err := a.Authenticate(context.Background(), prepareRequest(http.Header{"Authorization": {"bearer user"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, "user", claims.Subject)
+
+	_, err = a.Authenticate(context.Background(), prepareRequest(http.Header{"Authorization": {"Basic dXNlcjpwYXNz"}}))
+	assert.Equal(t, errors.ErrNoCredentials, err)
+
+	_, err = a.Authenticate(context.Background(), prepareRequest(http.Header{}))
+	assert.Equal(t, errors.ErrNoCredentials, err)
+}
+
+func TestMTLSAuthenticator(t *testing.T) {
+	a := NewMTLSAuthenticator("SERVICE", []string{"auth-1"})
+
+	request := prepareRequest(http.Header{})
+	_, err := a.Authenticate(context.Background(), request)
+	assert.Equal(t, errors.ErrNoCredentials, err)
+
+	request.Principal = "spiffe://xquare/batch"
+	claims, err := a.Authenticate(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, "spiffe://xquare/batch", claims.Subject)
+	assert.Equal(t, "SERVICE", claims.Role)
+}
+
+func TestChainFirstMatch(t *testing.T) {
+	chain := &Chain{Mode: ChainFirstMatch, Authenticators: []Authenticator{
+		NewCookieAuthenticator("accessToken", verifyAsSubject),
+		NewBearerAuthenticator(verifyAsSubject),
+	}}
+
+	claims, name, err := chain.Authenticate(context.Background(), prepareRequest(http.Header{
+		"Cookie":        {"accessToken=cookie-user"},
+		"Authorization": {"Bearer invalid"},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "cookie", name)
+	assert.Equal(t, "cookie-user", claims.Subject)
+
+	_, name, err = chain.Authenticate(context.Background(), prepareRequest(http.Header{"Authorization": {"Bearer invalid"}}))
+	assert.IsType(t, &jwt.ValidationError{}, err)
+	assert.Equal(t, "bearer", name)
+
+	_, _, err = chain.Authenticate(context.Background(), prepareRequest(http.Header{}))
+	assert.Equal(t, errors.ErrNoCredentials, err)
+}
+
+func TestChainAllMustPass(t *testing.T) {
+	chain := &Chain{Mode: ChainAllMustPass, Authenticators: []Authenticator{
+		NewBearerAuthenticator(verifyAsSubject),
+		NewMTLSAuthenticator("SERVICE", nil),
+	}}
+
+	request := prepareRequest(http.Header{"Authorization": {"Bearer user"}})
+
+	_, name, err := chain.Authenticate(context.Background(), request)
+	assert.IsType(t, errors.UnauthenticatedError{}, err)
+	assert.Equal(t, "mtls", name)
+
+	request.Principal = "spiffe://xquare/gateway"
+	claims, name, err := chain.Authenticate(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, "bearer", name)
+	assert.Equal(t, "user", claims.Subject)
+
+	request.Request.Header.Set("Authorization", "Bearer invalid")
+	_, _, err = chain.Authenticate(context.Background(), request)
+	assert.IsType(t, &jwt.ValidationError{}, err)
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+	"github.com/team-xquare/contour-middleware/pkg/metrics"
+)
+
+// TokenCache is a bounded LRU cache of the claims of tokens whose signature
+// has been verified. Entries are dropped when the token expires, and at the
+// latest after the TTL of the cache so that tokens signed with a key that
+// has since been removed are not accepted for long. Cached claims are
+// shared and must not be modified.
+type TokenCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List
+}
+
+type tokenCacheEntry struct {
+	key       [sha256.Size]byte
+	claims    *jwt.JWTClaims
+	expiresAt time.Time
+}
+
+func NewTokenCache(size int, ttl time.Duration) *TokenCache {
+	return &TokenCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[[sha256.Size]byte]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Get returns the claims of token if it is cached and has not expired.
+func (c *TokenCache) Get(token string) (*jwt.JWTClaims, bool) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if ok && !now.Before(element.Value.(*tokenCacheEntry).expiresAt) {
+		c.remove(element)
+		ok = false
+	}
+	if !ok {
+		metrics.TokenCacheLookups.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	metrics.TokenCacheLookups.WithLabelValues("hit").Inc()
+	c.lru.MoveToFront(element)
+	return element.Value.(*tokenCacheEntry).claims, true
+}
+
+// Add caches the verified claims of token.
+func (c *TokenCache) Add(token string, claims *jwt.JWTClaims) {
+	expiresAt := time.Now().Add(c.ttl)
+	if claims.ExpiresAt != 0 && time.Unix(claims.ExpiresAt, 0).Before(expiresAt) {
+		expiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+	if !time.Now().Before(expiresAt) {
+		return
+	}
+
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.lru.PushFront(&tokenCacheEntry{key: key, claims: claims, expiresAt: expiresAt})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *TokenCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*tokenCacheEntry).key)
+}
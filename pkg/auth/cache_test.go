@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+	"github.com/team-xquare/contour-middleware/pkg/metrics"
+)
+
+// cacheLookups returns a function reporting the token cache hits and misses
+// counted since cacheLookups was called.
+func cacheLookups() func() (float64, float64) {
+	hits := metrics.TokenCacheLookups.WithLabelValues("hit")
+	misses := metrics.TokenCacheLookups.WithLabelValues("miss")
+	hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+	return func() (float64, float64) {
+		return testutil.ToFloat64(hits) - hitsBefore, testutil.ToFloat64(misses) - missesBefore
+	}
+}
+
+func TestTokenCacheEviction(t *testing.T) {
+	cache := NewTokenCache(2, time.Minute)
+	lookups := cacheLookups()
+
+	for _, token := range []string{"a", "b"} {
+		claims := &jwt.JWTClaims{}
+		claims.Subject = token
+		cache.Add(token, claims)
+	}
+
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+
+	cache.Add("c", &jwt.JWTClaims{})
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	claims, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", claims.Subject)
+
+	hits, misses := lookups()
+	assert.Equal(t, 2.0, hits)
+	assert.Equal(t, 1.0, misses)
+}
+
+func TestTokenCacheExpiry(t *testing.T) {
+	cache := NewTokenCache(10, time.Minute)
+
+	expired := &jwt.JWTClaims{}
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	cache.Add("expired", expired)
+
+	_, ok := cache.Get("expired")
+	assert.False(t, ok)
+
+	cache = NewTokenCache(10, 0)
+	cache.Add("no-ttl", &jwt.JWTClaims{})
+
+	_, ok = cache.Get("no-ttl")
+	assert.False(t, ok)
+}
+
+func TestCheckWithTokenCache(t *testing.T) {
+	keyring := jwt.NewKeyring([]byte("secret"))
+	denylist := jwt.NewDenylist()
+	cache := NewTokenCache(10, time.Minute)
+	lookups := cacheLookups()
+
+	check := NewCheckService(logrus.New(),
+		WithParser(&jwt.Parser{Keys: keyring, Revocations: denylist}),
+		WithTokenCache(cache),
+	)
+
+	claims := &jwt.JWTClaims{}
+	claims.Id = "1"
+	claims.Subject = "kimxwan0319"
+	claims.ExpiresAt = time.Now().Add(time.Minute).Unix()
+	token, err := keyring.Sign(claims)
+	assert.NoError(t, err)
+
+	request := prepareRequest(http.Header{"Authorization": {"Bearer " + token}})
+
+	for i := 0; i < 2; i++ {
+		res, err := check.Check(context.Background(), request)
+		assert.NoError(t, err)
+		assert.True(t, res.Allow)
+	}
+	hits, misses := lookups()
+	assert.Equal(t, 1.0, hits)
+	assert.Equal(t, 1.0, misses)
+
+	assert.NoError(t, denylist.Revoke(jwt.Revocation{ID: "1"}))
+
+	res, err := check.Check(context.Background(), request)
+	assert.Equal(t, "revoked", jwt.Reason(err))
+	assert.Equal(t, http.StatusUnauthorized, res.Response.StatusCode)
+
+	// Context overrides still apply to cached tokens.
+	claims.Id = "2"
+	token, err = keyring.Sign(claims)
+	assert.NoError(t, err)
+
+	request = prepareRequest(http.Header{"Authorization": {"Bearer " + token}})
+	res, err = check.Check(context.Background(), request)
+	assert.NoError(t, err)
+	assert.True(t, res.Allow)
+
+	request.Context = map[string]string{contextKeyAudience: "other"}
+	res, err = check.Check(context.Background(), request)
+	assert.Equal(t, "audience_invalid", jwt.Reason(err))
+	assert.False(t, res.Allow)
+	hits, misses = lookups()
+	assert.Equal(t, 3.0, hits)
+	assert.Equal(t, 2.0, misses)
+}
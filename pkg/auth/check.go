@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
@@ -12,6 +13,16 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/team-xquare/contour-middleware/pkg/errors"
 	"github.com/team-xquare/contour-middleware/pkg/jwt"
+	"github.com/team-xquare/contour-middleware/pkg/metrics"
+)
+
+const realm = "xquare"
+
+// Context extension keys that override the configured JWT issuer and
+// audience, so each virtual host can only be reached with its own tokens.
+const (
+	contextKeyIssuer   = "jwt-issuer"
+	contextKeyAudience = "jwt-audience"
 )
 
 type CheckService interface {
@@ -19,15 +30,162 @@ type CheckService interface {
 }
 
 type checkService struct {
-	log *logrus.Logger
+	log       *logrus.Logger
+	parser    *jwt.Parser
+	headers   []ClaimHeader
+	policies  Policies
+	mode      AuthMode
+	allowlist []string
+	htpasswd  *HTPasswd
+
+	apiKeys      *APIKeyStore
+	apiKeyHeader string
+	apiKeyQuery  string
+
+	mtlsRole        string
+	mtlsAuthorities []string
+
+	chainMode          ChainMode
+	authenticatorTypes []AuthenticatorType
+	chain              *Chain
+
+	cache *TokenCache
+}
+
+type Option func(*checkService)
+
+// WithParser sets the parser used to verify JWT tokens.
+func WithParser(p *jwt.Parser) Option {
+	return func(c *checkService) {
+		c.parser = p
+	}
+}
+
+// WithClaimHeaders sets the claims forwarded as request headers.
+func WithClaimHeaders(h []ClaimHeader) Option {
+	return func(c *checkService) {
+		c.headers = h
+	}
+}
+
+// WithPolicies sets the route policies requests are authorized against.
+func WithPolicies(p Policies) Option {
+	return func(c *checkService) {
+		c.policies = p
+	}
+}
+
+// WithAuthMode sets the mode used by routes that do not declare their own.
+func WithAuthMode(mode AuthMode) Option {
+	return func(c *checkService) {
+		c.mode = mode
+	}
+}
+
+// WithAllowlistedPaths sets the paths that may be reached anonymously in
+// the required-except-allowlisted-paths mode. A trailing "*" matches any
+// path with the given prefix.
+func WithAllowlistedPaths(paths []string) Option {
+	return func(c *checkService) {
+		c.allowlist = paths
+	}
 }
 
-func NewCheckService(l *logrus.Logger) CheckService {
-	return &checkService{
-		log: l,
+// WithHTPasswd enables HTTP Basic authentication against h. Without it,
+// Basic credentials are ignored and the request is treated as anonymous.
+func WithHTPasswd(h *HTPasswd) Option {
+	return func(c *checkService) {
+		c.htpasswd = h
 	}
 }
 
+// WithAPIKeys enables API key authentication against store. The key is read
+// from header, or from the query parameter when the header is absent; an
+// empty query disables the query parameter.
+func WithAPIKeys(store *APIKeyStore, header string, query string) Option {
+	return func(c *checkService) {
+		c.apiKeys = store
+		c.apiKeyHeader = header
+		c.apiKeyQuery = query
+	}
+}
+
+// WithMTLSIdentity sets the role and authorities given to callers
+// identified by their client certificate.
+func WithMTLSIdentity(role string, authorities []string) Option {
+	return func(c *checkService) {
+		c.mtlsRole = role
+		c.mtlsAuthorities = authorities
+	}
+}
+
+// WithAuthenticators sets the authenticators run for every request, in
+// order. By default the cookie and bearer authenticators run, followed by
+// the API key and basic authenticators when they are configured.
+// Authenticators whose credential store is not configured are skipped.
+func WithAuthenticators(mode ChainMode, types ...AuthenticatorType) Option {
+	return func(c *checkService) {
+		c.chainMode = mode
+		c.authenticatorTypes = types
+	}
+}
+
+// WithTokenCache caches the claims of verified tokens in cache, so their
+// signature is not checked again on every request. The claims are still
+// validated every time.
+func WithTokenCache(cache *TokenCache) Option {
+	return func(c *checkService) {
+		c.cache = cache
+	}
+}
+
+func NewCheckService(l *logrus.Logger, opts ...Option) CheckService {
+	c := &checkService{
+		log:       l,
+		parser:    jwt.DefaultParser(),
+		headers:   DefaultClaimHeaders,
+		mode:      AuthModeOptional,
+		chainMode: ChainFirstMatch,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.chain = c.newChain()
+
+	return c
+}
+
+func (c *checkService) newChain() *Chain {
+	types := c.authenticatorTypes
+	if types == nil {
+		types = []AuthenticatorType{AuthenticatorCookie, AuthenticatorBearer, AuthenticatorAPIKey, AuthenticatorBasic}
+	}
+
+	chain := &Chain{Mode: c.chainMode}
+	for _, t := range types {
+		switch t {
+		case AuthenticatorCookie:
+			chain.Authenticators = append(chain.Authenticators, NewCookieAuthenticator("accessToken", c.parseJWTToken))
+		case AuthenticatorBearer:
+			chain.Authenticators = append(chain.Authenticators, NewBearerAuthenticator(c.parseJWTToken))
+		case AuthenticatorAPIKey:
+			if c.apiKeys != nil {
+				chain.Authenticators = append(chain.Authenticators, NewAPIKeyAuthenticator(c.apiKeys, c.apiKeyHeader, c.apiKeyQuery))
+			}
+		case AuthenticatorBasic:
+			if c.htpasswd != nil {
+				chain.Authenticators = append(chain.Authenticators, NewBasicAuthenticator(c.htpasswd))
+			}
+		case AuthenticatorMTLS:
+			chain.Authenticators = append(chain.Authenticators, NewMTLSAuthenticator(c.mtlsRole, c.mtlsAuthorities))
+		}
+	}
+
+	return chain
+}
+
 func (c *checkService) Check(ctx context.Context, request *Request) (*Response, error) {
 	c.log.Infof("checking request host: %s, path:%s, id: %s",
 		request.Request.URL.Host,
@@ -35,58 +193,61 @@ func (c *checkService) Check(ctx context.Context, request *Request) (*Response,
 		request.ID,
 	)
 
-	var tokenString string
-	var tokenType string
+	// Forged claim headers are rejected on every route, including those
+	// that skip authentication, since they would reach the upstream as is.
+	availableHeaders := c.findNotAvailableHeader(request)
+	if len(availableHeaders) != 0 {
+		err := errors.NewInvalidHeaderError(availableHeaders)
+		return c.responseUnauthorizedError(err).decidedBy("claim headers sent by the client"), err
+	}
 
-	if c.isAvailableCookie(request) {
-		tokenString = c.getAccessTokenFromCookie(request)
-	} else {
-		availableHeaders := c.findNotAvailableHeader(request)
-		if len(availableHeaders) != 0 {
-			err := errors.NewInvalidHeaderError(availableHeaders)
-			return c.responseUnauthorizedError(err), err
-		}
+	mode, err := c.authMode(request)
+	if err != nil {
+		return c.responseInternelServerError(err).decidedBy("context extension " + contextKeyAuthMode), err
+	}
+	if mode == AuthModeNone {
+		return c.responseOKWithoutHeader().decidedBy("auth mode " + string(mode)), nil
+	}
+
+	policies := c.matchPolicies(request)
 
-		tokenType, tokenString = c.getTokenInfo(request)
-		if len(tokenType) == 0 && len(tokenString) == 0 {
-			return c.responseOKWithoutHeader(), nil
+	claims, authenticator, err := c.chain.Authenticate(ctx, request)
+	if err == errors.ErrNoCredentials {
+		if mode == AuthModeRequired {
+			err := errors.NewUnauthenticatedError("route requires a token")
+			return c.responseUnauthorizedError(err).decidedBy("auth mode " + string(mode)), err
 		}
-		if tokenType == "basic" || tokenType == "Basic" {
-			return c.responseOKWithoutHeader(), nil
+		if policy := identityPolicy(policies); policy != nil {
+			err := errors.NewUnauthenticatedError("route requires a token")
+			return c.responseUnauthorizedError(err).decidedBy("policy " + policy.Name), err
 		}
+		return c.responseOKWithoutHeader().decidedBy("auth mode " + string(mode)), nil
 	}
-
-	header, err := c.createHeaderFromJWTToken(tokenString)
 	if err != nil {
-		if _, ok := err.(*jwt.ValidationError); ok {
-			return c.responseUnauthorizedError(err), err
+		switch err.(type) {
+		case *jwt.ValidationError:
+			metrics.TokenValidationFailures.WithLabelValues(jwt.Reason(err)).Inc()
+			return c.responseUnauthorizedError(err).decidedBy("authenticator " + authenticator), err
+		case errors.InvalidCredentialsError, errors.UnauthenticatedError:
+			return c.responseUnauthorizedError(err).decidedBy("authenticator " + authenticator), err
 		}
-		return c.responseInternelServerError(err), err
+		return c.responseInternelServerError(err).decidedBy("authenticator " + authenticator), err
 	}
-	return c.responseOKWithHeader(header), nil
-}
 
-func (c *checkService) isAvailableCookie(request *Request) bool {
-	accessToken, err := request.Request.Cookie("accessToken")
-	if err != nil || accessToken == nil {
-		return false
-	}
-	return true
-}
+	c.log.Infof("authenticated %s by %s", claims.Subject, authenticator)
 
-func (c *checkService) getAccessTokenFromCookie(request *Request) string {
-	accessToken, err := request.Request.Cookie("accessToken")
-	if err != nil || accessToken == nil {
-		return ""
-	} else {
-		return accessToken.Value
+	for _, policy := range policies {
+		if err := policy.Authorize(claims); err != nil {
+			return c.responseForbiddenError(err).decidedBy("policy " + policy.Name), err
+		}
 	}
+
+	return c.responseOKWithHeader(c.createHeaderFromJWTClaims(claims)).decidedBy("authenticator " + authenticator), nil
 }
 
 func (c *checkService) findNotAvailableHeader(request *Request) []string {
-	blackList := []string{"Request-User-Id", "Request-User-Role", "Request-User-Authorities"}
 	result := []string{}
-	for _, key := range blackList {
+	for _, key := range claimHeaderNames(c.headers) {
 		if len(request.Request.Header.Get(key)) != 0 {
 			result = append(result, key)
 		}
@@ -95,32 +256,65 @@ func (c *checkService) findNotAvailableHeader(request *Request) []string {
 	return result
 }
 
-func (c *checkService) getTokenInfo(request *Request) (string, string) {
-	token := request.Request.Header.Get("Authorization")
-	splittedToken := strings.Split(token, " ")
-	if len(splittedToken) != 2 {
-		return "", ""
+func (c *checkService) expectations(request *Request) jwt.Expectations {
+	expect := c.parser.Expect
+	if issuer, ok := request.Context[contextKeyIssuer]; ok {
+		expect.Issuer = issuer
 	}
-	return splittedToken[0], splittedToken[1]
+	if audience, ok := request.Context[contextKeyAudience]; ok {
+		expect.Audience = audience
+	}
+
+	return expect
 }
 
-func (c *checkService) createHeaderFromJWTToken(jwtToken string) (http.Header, error) {
-	var headers = make(http.Header)
+func (c *checkService) parseJWTToken(jwtToken string, request *Request) (*jwt.JWTClaims, error) {
+	if c.cache == nil {
+		return c.parser.ParseExpecting(jwtToken, c.expectations(request))
+	}
 
-	claims, err := jwt.ParseJWTToken(jwtToken)
-	if err != nil {
+	claims, cached := c.cache.Get(jwtToken)
+	if !cached {
+		var err error
+		if claims, err = c.parser.Verify(jwtToken); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.parser.Validate(claims, c.expectations(request)); err != nil {
 		return nil, err
 	}
 
-	headers.Add("Request-User-Id", claims.Subject)
-	headers.Add("Request-User-Role", claims.Role)
-	headers.Add("Request-User-Authorities", strings.Join(claims.Authorities, " "))
-	// for _, v := range claims.Authorities {
-	// 	headers.Add("Request-User-Authorities", v)
-	// }
-	headers.Add("Request-Id", c.getRequestId())
+	if !cached {
+		c.cache.Add(jwtToken, claims)
+	}
 
-	return headers, nil
+	return claims, nil
+}
+
+func (c *checkService) createHeaderFromJWTClaims(claims *jwt.JWTClaims) http.Header {
+	headers := ClaimHeaders(c.headers, claims)
+	headers.Add(RequestIdHeader, c.getRequestId())
+
+	return headers
+}
+
+// denialReason returns a short identifier for the cause of a denial.
+func denialReason(err error) string {
+	switch err.(type) {
+	case *jwt.ValidationError:
+		return jwt.Reason(err)
+	case errors.InvalidHeaderError:
+		return "invalid_header"
+	case errors.UnauthenticatedError:
+		return "unauthenticated"
+	case errors.ForbiddenError:
+		return "forbidden"
+	case errors.InvalidCredentialsError:
+		return "invalid_credentials"
+	}
+
+	return "unknown"
 }
 
 func (c *checkService) getRequestId() string {
@@ -140,13 +334,42 @@ func (c *checkService) responseInternelServerError(err error) *Response {
 }
 
 func (c *checkService) responseUnauthorizedError(err error) *Response {
-	c.log.Info(err, 401)
+	c.log.WithField("reason", denialReason(err)).Info(err, 401)
 	defer sentry.Flush(2 * time.Second)
 	sentry.CaptureException(err)
 	return &Response{
 		Allow: false,
 		Response: http.Response{
 			StatusCode: http.StatusUnauthorized,
+			Header:     http.Header{"Www-Authenticate": {c.authenticateChallenge(err)}},
+		},
+	}
+}
+
+// authenticateChallenge builds the WWW-Authenticate header of a 401 as
+// described in RFC 6750.
+func (c *checkService) authenticateChallenge(err error) string {
+	if _, ok := err.(errors.InvalidCredentialsError); ok {
+		return fmt.Sprintf("Basic realm=%q", realm)
+	}
+
+	challenge := fmt.Sprintf("Bearer realm=%q", realm)
+	if _, ok := err.(*jwt.ValidationError); ok {
+		challenge += `, error="invalid_token"`
+	}
+
+	return challenge
+}
+
+func (c *checkService) responseForbiddenError(err error) *Response {
+	c.log.WithField("reason", denialReason(err)).Info(err, 403)
+	defer sentry.Flush(2 * time.Second)
+	sentry.CaptureException(err)
+	return &Response{
+		Allow: false,
+		Response: http.Response{
+			StatusCode: http.StatusForbidden,
+			Body:       ioutil.NopCloser(strings.NewReader(err.Error())),
 		},
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 
@@ -14,13 +15,23 @@ import (
 	"github.com/team-xquare/contour-middleware/pkg/jwt"
 )
 
+var testKeyring = jwt.NewKeyring([]byte("secret"))
+
+var testParser = &jwt.Parser{Keys: testKeyring}
+
 func prepareCheckService() CheckService {
 	l := logrus.New()
-	check := NewCheckService(l)
+	check := NewCheckService(l, WithParser(testParser))
 
 	return check
 }
 
+func signToken(claims *jwt.JWTClaims) string {
+	token, _ := testKeyring.Sign(claims)
+
+	return token
+}
+
 func TestCheckWithoutJWTToken(t *testing.T) {
 	ctx := context.Background()
 	request := &Request{
@@ -48,6 +59,7 @@ func TestCheckWithoutJWTToken(t *testing.T) {
 		Response: http.Response{
 			StatusCode: http.StatusOK,
 		},
+		DecidedBy: "auth mode optional",
 	}, res)
 }
 
@@ -59,7 +71,7 @@ func TestCheckWithBearerToken(t *testing.T) {
 	claims.Authorities = []string{"auth-1", "auth-2", "auth-3"}
 	claims.Role = "STU"
 	claims.ExpiresAt = time.Now().Add(time.Minute * 15).Unix()
-	token := claims.ToJWTToken()
+	token := signToken(&claims)
 
 	request := &Request{
 		ID:      "100",
@@ -89,7 +101,7 @@ func TestCheckWithBearerToken(t *testing.T) {
 			Header: http.Header{
 				"Request-User-Id":          {"1"},
 				"Request-User-Role":        {"STU"},
-				"Request-User-Authorities": {"auth-1", "auth-2", "auth-3"},
+				"Request-User-Authorities": {"auth-1 auth-2 auth-3"},
 				"Request-Id":               {""},
 			},
 		},
@@ -131,7 +143,9 @@ func TestCheckWithInvalidJWTToken(t *testing.T) {
 		Allow: false,
 		Response: http.Response{
 			StatusCode: http.StatusUnauthorized,
+			Header:     http.Header{"Www-Authenticate": {`Bearer realm="xquare", error="invalid_token"`}},
 		},
+		DecidedBy: "authenticator bearer",
 	}, res)
 }
 
@@ -162,10 +176,38 @@ func TestCheckWithInvalidHeaders(t *testing.T) {
 		Allow: false,
 		Response: http.Response{
 			StatusCode: http.StatusUnauthorized,
+			Header:     http.Header{"Www-Authenticate": {`Bearer realm="xquare"`}},
 		},
+		DecidedBy: "claim headers sent by the client",
 	}, res)
 }
 
+func TestCheckWithInvalidHeadersWithoutAuth(t *testing.T) {
+	ctx := context.Background()
+
+	request := &Request{
+		ID:      "100",
+		Context: map[string]string{"auth-mode": "none"},
+		Request: http.Request{
+			Header: http.Header{"Request-User-Id": {"admin"}, "Request-User-Role": {"ADMIN"}},
+			Method: "GET",
+			Proto:  "HTTP/1.1",
+			URL: &url.URL{
+				Scheme: "https",
+				Host:   "example.com",
+				Path:   "/public",
+			},
+		},
+	}
+
+	check := prepareCheckService()
+
+	res, err := check.Check(ctx, request)
+	assert.IsType(t, errors.InvalidHeaderError{}, err)
+	assert.False(t, res.Allow)
+	assert.Equal(t, http.StatusUnauthorized, res.Response.StatusCode)
+}
+
 func TestCheckWithBasicToken(t *testing.T) {
 	ctx := context.Background()
 
@@ -195,6 +237,7 @@ func TestCheckWithBasicToken(t *testing.T) {
 		Response: http.Response{
 			StatusCode: http.StatusOK,
 		},
+		DecidedBy: "auth mode optional",
 	}, res)
 }
 
@@ -206,13 +249,13 @@ func TestCheckWithCookieToken(t *testing.T) {
 	claims.Authorities = []string{"auth-1", "auth-2", "auth-3"}
 	claims.Role = "STU"
 	claims.ExpiresAt = time.Now().Add(time.Minute * 15).Unix()
-	token := claims.ToJWTToken()
+	token := signToken(&claims)
 
 	request := &Request{
 		ID:      "100",
 		Context: map[string]string{"k1": "v1", "k2": "v2"},
 		Request: http.Request{
-			Header: http.Header{"User-Agent": {"Foo"}, "Cookie": {"accessToken="+ token}},
+			Header: http.Header{"User-Agent": {"Foo"}, "Cookie": {"accessToken=" + token}},
 			Method: "GET",
 			Proto:  "HTTP/1.1",
 			URL: &url.URL{
@@ -236,7 +279,7 @@ func TestCheckWithCookieToken(t *testing.T) {
 			Header: http.Header{
 				"Request-User-Id":          {"1"},
 				"Request-User-Role":        {"STU"},
-				"Request-User-Authorities": {"auth-1", "auth-2", "auth-3"},
+				"Request-User-Authorities": {"auth-1 auth-2 auth-3"},
 				"Request-Id":               {""},
 			},
 		},
@@ -247,3 +290,314 @@ func TestCheckWithCookieToken(t *testing.T) {
 	assert.Equal(t, expect.Response.Header.Get("Request-User-Authorities"), res.Response.Header.Get("Request-User-Authorities"))
 	assert.Equal(t, 36, len(res.Response.Header.Get("Request-Id")))
 }
+
+func TestCheckWithAudienceFromContext(t *testing.T) {
+	ctx := context.Background()
+
+	claims := jwt.JWTClaims{}
+	claims.Subject = "1"
+	claims.Role = "STU"
+	claims.Audience = jwt.Audience{"feed"}
+	claims.ExpiresAt = time.Now().Add(time.Minute * 15).Unix()
+	token := signToken(&claims)
+
+	request := &Request{
+		ID:      "100",
+		Context: map[string]string{"jwt-audience": "timetable"},
+		Request: http.Request{
+			Header: http.Header{"User-Agent": {"Foo"}, "Authorization": {"Bearer " + token}},
+			Method: "GET",
+			Proto:  "HTTP/1.1",
+			URL: &url.URL{
+				Scheme:   "https",
+				Host:     "timetable.example.com",
+				Path:     "example",
+				RawQuery: "query",
+			},
+		},
+	}
+
+	check := prepareCheckService()
+
+	res, err := check.Check(ctx, request)
+	assert.Equal(t, "audience_invalid", jwt.Reason(err))
+	assert.Equal(t, http.StatusUnauthorized, res.Response.StatusCode)
+
+	request.Context = map[string]string{"jwt-audience": "feed"}
+
+	res, err = check.Check(ctx, request)
+	assert.Equal(t, nil, err)
+	assert.True(t, res.Allow)
+}
+
+func TestCheckWithPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	policies, err := NewPolicies([]Policy{{Name: "admin", PathPrefix: "/admin", Roles: []string{"SCH"}}})
+	assert.NoError(t, err)
+	check := NewCheckService(logrus.New(), WithParser(testParser), WithPolicies(policies))
+
+	claims := jwt.JWTClaims{}
+	claims.Subject = "1"
+	claims.Role = "STU"
+	claims.ExpiresAt = time.Now().Add(time.Minute * 15).Unix()
+	token := signToken(&claims)
+
+	request := &Request{
+		ID: "100",
+		Request: http.Request{
+			Header: http.Header{"User-Agent": {"Foo"}, "Authorization": {"Bearer " + token}},
+			Method: "GET",
+			Proto:  "HTTP/1.1",
+			URL: &url.URL{
+				Scheme: "https",
+				Host:   "example.com",
+				Path:   "/admin/users",
+			},
+		},
+	}
+
+	res, err := check.Check(ctx, request)
+	assert.IsType(t, errors.ForbiddenError{}, err)
+	assert.False(t, res.Allow)
+	assert.Equal(t, http.StatusForbidden, res.Response.StatusCode)
+	assert.Equal(t, err.Error(), res.AsV3().GetDeniedResponse().GetBody())
+	assert.Equal(t, "policy admin", res.DecidedBy)
+
+	request.Request.Header.Del("Authorization")
+
+	res, err = check.Check(ctx, request)
+	assert.IsType(t, errors.UnauthenticatedError{}, err)
+	assert.Equal(t, http.StatusUnauthorized, res.Response.StatusCode)
+	assert.Equal(t, "policy admin", res.DecidedBy)
+
+	request.Request.URL.Path = "/public"
+
+	res, err = check.Check(ctx, request)
+	assert.Equal(t, nil, err)
+	assert.True(t, res.Allow)
+}
+
+func TestCheckWithContextExtensions(t *testing.T) {
+	ctx := context.Background()
+
+	claims := jwt.JWTClaims{}
+	claims.Subject = "1"
+	claims.Role = "STU"
+	claims.Authorities = []string{"auth-1"}
+	claims.ExpiresAt = time.Now().Add(time.Minute * 15).Unix()
+	token := signToken(&claims)
+
+	check := prepareCheckService()
+
+	for _, tc := range []struct {
+		context       map[string]string
+		authorization string
+		status        int
+	}{
+		{map[string]string{"auth-mode": "required"}, "", http.StatusUnauthorized},
+		{map[string]string{"auth-mode": "required"}, "Bearer " + token, http.StatusOK},
+		{map[string]string{"auth-mode": "optional"}, "", http.StatusOK},
+		{map[string]string{"auth-mode": "none"}, "Bearer invalid.token", http.StatusOK},
+		{map[string]string{"auth-mode": "sometimes"}, "", http.StatusInternalServerError},
+		{map[string]string{"required-role": "SCH,STU"}, "Bearer " + token, http.StatusOK},
+		{map[string]string{"required-role": "SCH"}, "Bearer " + token, http.StatusForbidden},
+		{map[string]string{"required-role": "SCH"}, "", http.StatusUnauthorized},
+		{map[string]string{"required-authorities": "auth-1 auth-2"}, "Bearer " + token, http.StatusForbidden},
+		{map[string]string{"required-authorities": "auth-1"}, "Bearer " + token, http.StatusOK},
+	} {
+		request := &Request{
+			ID:      "100",
+			Context: tc.context,
+			Request: http.Request{
+				Header: http.Header{"User-Agent": {"Foo"}},
+				Method: "GET",
+				Proto:  "HTTP/1.1",
+				URL: &url.URL{
+					Scheme: "https",
+					Host:   "example.com",
+					Path:   "/example",
+				},
+			},
+		}
+		if len(tc.authorization) != 0 {
+			request.Request.Header.Set("Authorization", tc.authorization)
+		}
+
+		res, _ := check.Check(ctx, request)
+		assert.Equal(t, tc.status, res.Response.StatusCode, tc.context)
+	}
+}
+
+func TestCheckWithDefaultAuthMode(t *testing.T) {
+	ctx := context.Background()
+
+	check := NewCheckService(logrus.New(),
+		WithAuthMode(AuthModeRequiredExceptAllowlisted),
+		WithAllowlistedPaths([]string{"/healthz", "/public/*"}),
+	)
+
+	for _, tc := range []struct {
+		path    string
+		context map[string]string
+		status  int
+	}{
+		{"/healthz", nil, http.StatusOK},
+		{"/healthz/deep", nil, http.StatusUnauthorized},
+		{"/public/notice", nil, http.StatusOK},
+		{"/private", nil, http.StatusUnauthorized},
+		{"/private", map[string]string{"auth-mode": "optional"}, http.StatusOK},
+	} {
+		request := &Request{
+			ID:      "100",
+			Context: tc.context,
+			Request: http.Request{
+				Header: http.Header{"User-Agent": {"Foo"}},
+				Method: "GET",
+				Proto:  "HTTP/1.1",
+				URL: &url.URL{
+					Scheme: "https",
+					Host:   "example.com",
+					Path:   tc.path,
+				},
+			},
+		}
+
+		res, _ := check.Check(ctx, request)
+		assert.Equal(t, tc.status, res.Response.StatusCode, tc.path)
+		if tc.status == http.StatusUnauthorized {
+			assert.Equal(t, `Bearer realm="xquare"`, res.Response.Header.Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestCheckWithVerifiedBasicCredentials(t *testing.T) {
+	ctx := context.Background()
+
+	h, _ := prepareHTPasswd(t, "legacy:"+bcryptSecret+":SCH:auth-1\n")
+	check := NewCheckService(logrus.New(), WithHTPasswd(h))
+
+	request := &Request{
+		ID: "100",
+		Request: http.Request{
+			Header: http.Header{"User-Agent": {"Foo"}},
+			Method: "GET",
+			Proto:  "HTTP/1.1",
+			URL: &url.URL{
+				Scheme: "https",
+				Host:   "example.com",
+				Path:   "example",
+			},
+		},
+	}
+
+	request.Request.SetBasicAuth("legacy", "secret")
+	res, err := check.Check(ctx, request)
+	assert.Equal(t, nil, err)
+	assert.True(t, res.Allow)
+	assert.Equal(t, "legacy", res.Response.Header.Get("Request-User-Id"))
+	assert.Equal(t, "SCH", res.Response.Header.Get("Request-User-Role"))
+	assert.Equal(t, "auth-1", res.Response.Header.Get("Request-User-Authorities"))
+
+	request.Request.SetBasicAuth("legacy", "wrong")
+	res, err = check.Check(ctx, request)
+	assert.IsType(t, errors.InvalidCredentialsError{}, err)
+	assert.Equal(t, http.StatusUnauthorized, res.Response.StatusCode)
+	assert.Equal(t, `Basic realm="xquare"`, res.Response.Header.Get("WWW-Authenticate"))
+}
+
+func TestCheckWithAPIKey(t *testing.T) {
+	ctx := context.Background()
+
+	check := NewCheckService(logrus.New(), WithAPIKeys(prepareAPIKeyStore(t), DefaultAPIKeyHeader, "api_key"))
+
+	for _, tc := range []struct {
+		header string
+		path   string
+		status int
+	}{
+		{"batch-key", "/example", http.StatusOK},
+		{"", "/example?api_key=batch-key", http.StatusOK},
+		{"retired-key", "/example", http.StatusUnauthorized},
+		{"", "/example?api_key=unknown", http.StatusUnauthorized},
+	} {
+		headers := map[string]string{"user-agent": "Foo"}
+		if len(tc.header) != 0 {
+			headers["x-api-key"] = tc.header
+		}
+
+		res, _ := check.Check(ctx, envoyRequest(tc.path, headers, nil))
+		assert.Equal(t, tc.status, res.Response.StatusCode, tc.path)
+		if tc.status == http.StatusOK {
+			assert.Equal(t, "batch-worker", res.Response.Header.Get("Request-User-Id"))
+			assert.Equal(t, "SYSTEM", res.Response.Header.Get("Request-User-Role"))
+		}
+	}
+}
+
+func TestCheckWithQueryInPath(t *testing.T) {
+	ctx := context.Background()
+
+	policies, err := NewPolicies([]Policy{{Name: "admin", PathRegex: "^/admin$", Roles: []string{"SCH"}}})
+	assert.NoError(t, err)
+	check := NewCheckService(logrus.New(),
+		WithPolicies(policies),
+		WithAuthMode(AuthModeRequiredExceptAllowlisted),
+		WithAllowlistedPaths([]string{"/healthz"}),
+	)
+
+	// The admin route is optional, so that only the policy can deny it.
+	optional := map[string]string{"auth-mode": "optional"}
+
+	for _, tc := range []struct {
+		path    string
+		context map[string]string
+		status  int
+	}{
+		{"/admin", optional, http.StatusUnauthorized},
+		{"/admin?x=1", optional, http.StatusUnauthorized},
+		{"/healthz", nil, http.StatusOK},
+		{"/healthz?probe=1", nil, http.StatusOK},
+	} {
+		res, _ := check.Check(ctx, envoyRequest(tc.path, nil, tc.context))
+		assert.Equal(t, tc.status, res.Response.StatusCode, tc.path)
+	}
+}
+
+// envoyRequest converts a request shaped like the ones Envoy sends, with
+// the query string in the path.
+func envoyRequest(path string, headers map[string]string, context map[string]string) *Request {
+	return new(Request).FromV3(&CheckRequestV3{
+		Attributes: &envoy_service_auth_v3.AttributeContext{
+			Request: &envoy_service_auth_v3.AttributeContext_Request{
+				Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+					Id:       "100",
+					Method:   "GET",
+					Headers:  headers,
+					Path:     path,
+					Host:     "example.com",
+					Scheme:   "https",
+					Protocol: "HTTP/1.1",
+				},
+			},
+			ContextExtensions: context,
+		},
+	})
+}
+
+func TestCheckWithClaimHeaderMapping(t *testing.T) {
+	ctx := context.Background()
+
+	check := NewCheckService(logrus.New(),
+		WithParser(testParser),
+		WithClaimHeaders([]ClaimHeader{{Claim: "sub", Header: "X-User"}}),
+	)
+
+	// The default claim headers stay reserved when the mapping replaces
+	// them.
+	for _, header := range []string{"x-user", "request-user-id", "request-user-role"} {
+		res, err := check.Check(ctx, envoyRequest("/", map[string]string{header: "admin"}, nil))
+		assert.IsType(t, errors.InvalidHeaderError{}, err, header)
+		assert.Equal(t, http.StatusUnauthorized, res.Response.StatusCode, header)
+	}
+}
@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"bytes"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 
 	envoy_api_v2_core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -18,17 +21,21 @@ type Request struct {
 	Context map[string]string
 	Request http.Request
 	ID      string
+
+	// Principal identifies the client certificate Envoy verified on the
+	// downstream connection, if any.
+	Principal string
 }
 
 func (r *Request) FromV2(c *CheckRequestV2) *Request {
 	r.Request = http.Request{
-		URL: &url.URL{
-			Scheme:   c.GetAttributes().GetRequest().GetHttp().GetScheme(),
-			Host:     c.GetAttributes().GetRequest().GetHttp().GetHost(),
-			Path:     c.GetAttributes().GetRequest().GetHttp().GetPath(),
-			RawQuery: c.GetAttributes().GetRequest().GetHttp().GetQuery(),
-			Fragment: c.GetAttributes().GetRequest().GetHttp().GetFragment(),
-		},
+		URL: requestURL(
+			c.GetAttributes().GetRequest().GetHttp().GetScheme(),
+			c.GetAttributes().GetRequest().GetHttp().GetHost(),
+			c.GetAttributes().GetRequest().GetHttp().GetPath(),
+			c.GetAttributes().GetRequest().GetHttp().GetQuery(),
+			c.GetAttributes().GetRequest().GetHttp().GetFragment(),
+		),
 		Header: http.Header{},
 		Method: c.GetAttributes().GetRequest().GetHttp().GetMethod(),
 		Proto:  c.GetAttributes().GetRequest().GetHttp().GetProtocol(),
@@ -40,19 +47,20 @@ func (r *Request) FromV2(c *CheckRequestV2) *Request {
 
 	r.ID = c.GetAttributes().GetRequest().GetHttp().GetId()
 	r.Context = c.GetAttributes().GetContextExtensions()
+	r.Principal = c.GetAttributes().GetSource().GetPrincipal()
 
 	return r
 }
 
 func (r *Request) FromV3(c *CheckRequestV3) *Request {
 	r.Request = http.Request{
-		URL: &url.URL{
-			Scheme:   c.GetAttributes().GetRequest().GetHttp().GetScheme(),
-			Host:     c.GetAttributes().GetRequest().GetHttp().GetHost(),
-			Path:     c.GetAttributes().GetRequest().GetHttp().GetPath(),
-			RawQuery: c.GetAttributes().GetRequest().GetHttp().GetQuery(),
-			Fragment: c.GetAttributes().GetRequest().GetHttp().GetFragment(),
-		},
+		URL: requestURL(
+			c.GetAttributes().GetRequest().GetHttp().GetScheme(),
+			c.GetAttributes().GetRequest().GetHttp().GetHost(),
+			c.GetAttributes().GetRequest().GetHttp().GetPath(),
+			c.GetAttributes().GetRequest().GetHttp().GetQuery(),
+			c.GetAttributes().GetRequest().GetHttp().GetFragment(),
+		),
 		Header: http.Header{},
 		Method: c.GetAttributes().GetRequest().GetHttp().GetMethod(),
 		Proto:  c.GetAttributes().GetRequest().GetHttp().GetProtocol(),
@@ -64,13 +72,56 @@ func (r *Request) FromV3(c *CheckRequestV3) *Request {
 
 	r.ID = c.GetAttributes().GetRequest().GetHttp().GetId()
 	r.Context = c.GetAttributes().GetContextExtensions()
+	r.Principal = c.GetAttributes().GetSource().GetPrincipal()
 
 	return r
 }
 
+// requestURL builds the URL of a request from Envoy's attributes. Envoy
+// sends the query string as part of the path and leaves the query empty, so
+// the path is split at the first '?'.
+func requestURL(scheme, host, path, query, fragment string) *url.URL {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		if len(query) == 0 {
+			query = path[i+1:]
+		}
+		path = path[:i]
+	}
+
+	return &url.URL{
+		Scheme:   scheme,
+		Host:     host,
+		Path:     path,
+		RawQuery: query,
+		Fragment: fragment,
+	}
+}
+
 type Response struct {
 	Allow    bool
 	Response http.Response
+
+	// DecidedBy names what decided the outcome, such as the authenticator
+	// that identified the caller or the policy that denied it. It is not
+	// sent to Envoy.
+	DecidedBy string
+}
+
+func (r *Response) decidedBy(s string) *Response {
+	r.DecidedBy = s
+	return r
+}
+
+// body returns the response body, leaving it readable for later calls.
+func (r *Response) body() string {
+	if r.Response.Body == nil {
+		return ""
+	}
+
+	data, _ := ioutil.ReadAll(r.Response.Body)
+	r.Response.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	return string(data)
 }
 
 func (r *Response) AsV2() *CheckResponseV2 {
@@ -104,6 +155,7 @@ func (r *Response) AsV2() *CheckResponseV2 {
 		HttpResponse: &envoy_service_auth_v2.CheckResponse_DeniedResponse{
 			DeniedResponse: &envoy_service_auth_v2.DeniedHttpResponse{
 				Headers: convertHeaders(r.Response.Header),
+				Body:    r.body(),
 				Status: &envoy_type.HttpStatus{
 					Code: envoy_type.StatusCode(r.Response.StatusCode),
 				},
@@ -143,6 +195,7 @@ func (r *Response) AsV3() *CheckResponseV3 {
 		HttpResponse: &envoy_service_auth_v3.CheckResponse_DeniedResponse{
 			DeniedResponse: &envoy_service_auth_v3.DeniedHttpResponse{
 				Headers: convertHeaders(r.Response.Header),
+				Body:    r.body(),
 				Status: &envoy_type_v3.HttpStatus{
 					Code: envoy_type_v3.StatusCode(r.Response.StatusCode),
 				},
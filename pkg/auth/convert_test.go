@@ -139,6 +139,49 @@ func TestConvertRequestV3(t *testing.T) {
 	testConvertedRequest(t, actual.FromV3(&in))
 }
 
+func TestConvertRequestWithQueryInPath(t *testing.T) {
+	// Envoy sends the query string as part of the path.
+	for _, tc := range []struct {
+		path     string
+		query    string
+		expected url.URL
+	}{
+		{"/admin", "", url.URL{Scheme: "https", Host: "example.com", Path: "/admin"}},
+		{"/admin?x=1", "", url.URL{Scheme: "https", Host: "example.com", Path: "/admin", RawQuery: "x=1"}},
+		{"/admin?", "", url.URL{Scheme: "https", Host: "example.com", Path: "/admin"}},
+		{"/a?b=c?d", "", url.URL{Scheme: "https", Host: "example.com", Path: "/a", RawQuery: "b=c?d"}},
+		{"/admin?x=1", "y=2", url.URL{Scheme: "https", Host: "example.com", Path: "/admin", RawQuery: "y=2"}},
+	} {
+		v2 := CheckRequestV2{
+			Attributes: &envoy_service_auth_v2.AttributeContext{
+				Request: &envoy_service_auth_v2.AttributeContext_Request{
+					Http: &envoy_service_auth_v2.AttributeContext_HttpRequest{
+						Path:   tc.path,
+						Query:  tc.query,
+						Host:   "example.com",
+						Scheme: "https",
+					},
+				},
+			},
+		}
+		assert.Equal(t, &tc.expected, new(Request).FromV2(&v2).Request.URL, tc.path)
+
+		v3 := CheckRequestV3{
+			Attributes: &envoy_service_auth_v3.AttributeContext{
+				Request: &envoy_service_auth_v3.AttributeContext_Request{
+					Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+						Path:   tc.path,
+						Query:  tc.query,
+						Host:   "example.com",
+						Scheme: "https",
+					},
+				},
+			},
+		}
+		assert.Equal(t, &tc.expected, new(Request).FromV3(&v3).Request.URL, tc.path)
+	}
+}
+
 func TestConvertDenied(t *testing.T) {
 	response := Response{
 		Allow: false,
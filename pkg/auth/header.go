@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+// RequestIdHeader carries the id generated for each allowed request.
+const RequestIdHeader = "Request-Id"
+
+const (
+	HeaderFormatText = "text"
+	HeaderFormatJSON = "json"
+)
+
+// ClaimHeader forwards a claim to the upstream service as a request header.
+type ClaimHeader struct {
+	// Claim is a dotted path into the token claims, e.g. "school.id".
+	Claim string `yaml:"claim"`
+	// Header is the name of the header the claim is written to.
+	Header string `yaml:"header"`
+	// Join separates the elements of array claims. Defaults to a space.
+	Join string `yaml:"join"`
+	// Format is either "text", which writes scalars as they are and
+	// nested objects as JSON, or "json", which always writes JSON.
+	Format string `yaml:"format"`
+}
+
+// DefaultClaimHeaders are the headers forwarded when no mapping is
+// configured.
+var DefaultClaimHeaders = []ClaimHeader{
+	{Claim: "sub", Header: "Request-User-Id"},
+	{Claim: "role", Header: "Request-User-Role"},
+	{Claim: "authorities", Header: "Request-User-Authorities"},
+}
+
+// LoadClaimHeaders reads a YAML list of ClaimHeader from path.
+func LoadClaimHeaders(path string) ([]ClaimHeader, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []ClaimHeader
+	if err := yaml.Unmarshal(data, &headers); err != nil {
+		return nil, fmt.Errorf("invalid claim header mapping %s: %w", path, err)
+	}
+
+	if err := ValidateClaimHeaders(headers); err != nil {
+		return nil, fmt.Errorf("invalid claim header mapping %s: %w", path, err)
+	}
+
+	return headers, nil
+}
+
+func ValidateClaimHeaders(headers []ClaimHeader) error {
+	seen := map[string]bool{}
+	for _, h := range headers {
+		if len(h.Claim) == 0 {
+			return fmt.Errorf("header %q has no claim", h.Header)
+		}
+		if len(h.Header) == 0 || strings.ContainsAny(h.Header, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", h.Header)
+		}
+
+		name := textproto.CanonicalMIMEHeaderKey(h.Header)
+		if name == RequestIdHeader {
+			return fmt.Errorf("header %q is reserved", h.Header)
+		}
+		if seen[name] {
+			return fmt.Errorf("header %q is mapped twice", h.Header)
+		}
+		seen[name] = true
+
+		switch h.Format {
+		case "", HeaderFormatText, HeaderFormatJSON:
+		default:
+			return fmt.Errorf("header %q has unknown format %q", h.Header, h.Format)
+		}
+	}
+
+	return nil
+}
+
+// claimHeaderNames returns the headers written by the mapping, along with
+// the default claim headers, which clients must not be able to send
+// themselves. The defaults are included even when the mapping replaces
+// them, since upstream services may still trust them.
+func claimHeaderNames(headers []ClaimHeader) []string {
+	names := make([]string, 0, len(headers)+len(DefaultClaimHeaders))
+	seen := map[string]bool{}
+	for _, mapping := range [][]ClaimHeader{headers, DefaultClaimHeaders} {
+		for _, h := range mapping {
+			name := textproto.CanonicalMIMEHeaderKey(h.Header)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// ClaimHeaders returns the headers the mapping writes for claims. The
+// upstream service also receives a Request-Id generated for each request.
+func ClaimHeaders(mapping []ClaimHeader, claims *jwt.JWTClaims) http.Header {
+	headers := make(http.Header)
+	applyClaimHeaders(headers, mapping, claims)
+
+	return headers
+}
+
+func applyClaimHeaders(headers http.Header, mapping []ClaimHeader, claims *jwt.JWTClaims) {
+	all, err := claims.AsMap()
+	if err != nil {
+		return
+	}
+
+	for _, h := range mapping {
+		value, ok := jwt.LookupClaim(all, h.Claim)
+		if !ok {
+			continue
+		}
+
+		headers.Set(h.Header, h.render(value))
+	}
+}
+
+func (h *ClaimHeader) render(value interface{}) string {
+	if h.Format == HeaderFormatJSON {
+		return renderJSON(value)
+	}
+
+	if values, ok := value.([]interface{}); ok {
+		join := h.Join
+		if len(join) == 0 {
+			join = " "
+		}
+
+		rendered := make([]string, 0, len(values))
+		for _, v := range values {
+			rendered = append(rendered, renderText(v))
+		}
+		return strings.Join(rendered, join)
+	}
+
+	return renderText(value)
+}
+
+func renderText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+
+	return renderJSON(value)
+}
+
+func renderJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
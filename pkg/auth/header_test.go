@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+func TestClaimHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "headers.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+- claim: sub
+  header: Request-User-Id
+- claim: authorities
+  header: Request-User-Authorities
+  join: ","
+- claim: school.id
+  header: Request-User-School-Id
+- claim: school
+  header: Request-User-School
+- claim: grades
+  header: Request-User-Grades
+  format: json
+- claim: missing
+  header: Request-User-Missing
+`), 0600))
+
+	mapping, err := LoadClaimHeaders(path)
+	assert.NoError(t, err)
+
+	claims := &jwt.JWTClaims{
+		Authorities: []string{"auth-1", "auth-2"},
+		Extra: map[string]interface{}{
+			"school": map[string]interface{}{"id": "dsm"},
+			"grades": []int{1, 2},
+		},
+	}
+	claims.Subject = "1"
+
+	headers := ClaimHeaders(mapping, claims)
+
+	assert.Equal(t, http.Header{
+		"Request-User-Id":          {"1"},
+		"Request-User-Authorities": {"auth-1,auth-2"},
+		"Request-User-School-Id":   {"dsm"},
+		"Request-User-School":      {`{"id":"dsm"}`},
+		"Request-User-Grades":      {"[1,2]"},
+	}, headers)
+
+	assert.Equal(t, []string{
+		"Request-User-Id",
+		"Request-User-Authorities",
+		"Request-User-School-Id",
+		"Request-User-School",
+		"Request-User-Grades",
+		"Request-User-Missing",
+		"Request-User-Role",
+	}, claimHeaderNames(mapping))
+}
+
+func TestValidateClaimHeaders(t *testing.T) {
+	for _, headers := range [][]ClaimHeader{
+		{{Claim: "sub", Header: ""}},
+		{{Claim: "", Header: "Request-User-Id"}},
+		{{Claim: "sub", Header: "Request-Id"}},
+		{{Claim: "sub", Header: "Request-User-Id"}, {Claim: "role", Header: "request-user-id"}},
+		{{Claim: "sub", Header: "Request-User-Id", Format: "xml"}},
+	} {
+		assert.Error(t, ValidateClaimHeaders(headers))
+	}
+
+	assert.NoError(t, ValidateClaimHeaders(DefaultClaimHeaders))
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/team-xquare/contour-middleware/pkg/errors"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+	"github.com/team-xquare/contour-middleware/pkg/watch"
+)
+
+// dummyHash is compared against for unknown users so that the response
+// time does not reveal which users exist.
+var dummyHash = []byte("$2a$10$i9oJi/Np7O0zBzDOOTDfKOu60IY8HGHj1oT1WX2IiDBtvzvu1ljs.")
+
+type htpasswdUser struct {
+	hash        string
+	role        string
+	authorities []string
+}
+
+// HTPasswd verifies HTTP Basic credentials against an htpasswd style file.
+// Each line has the form
+//
+//	user:hash[:role[:authority,...]]
+//
+// where hash is a bcrypt ($2a$, $2b$, $2y$) or argon2 ($argon2id$,
+// $argon2i$) hash. Other hash schemes, including plain text, are rejected.
+type HTPasswd struct {
+	path string
+
+	mu    sync.RWMutex
+	users map[string]htpasswdUser
+}
+
+func LoadHTPasswd(path string) (*HTPasswd, error) {
+	h := &HTPasswd{path: path}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Reload re-reads the htpasswd file.
+func (h *HTPasswd) Reload() error {
+	data, err := ioutil.ReadFile(h.path)
+	if err != nil {
+		return err
+	}
+
+	users, err := parseHTPasswd(data)
+	if err != nil {
+		return fmt.Errorf("invalid htpasswd file %s: %w", h.path, err)
+	}
+
+	h.mu.Lock()
+	h.users = users
+	h.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the htpasswd file whenever it changes, until ctx is done.
+func (h *HTPasswd) Watch(ctx context.Context, interval time.Duration) {
+	watch.Reload(ctx, interval, "htpasswd file", h.Reload, h.path)
+}
+
+// Authenticate returns the identity of the user when the password matches.
+func (h *HTPasswd) Authenticate(username string, password string) (*jwt.JWTClaims, error) {
+	h.mu.RLock()
+	user, ok := h.users[username]
+	h.mu.RUnlock()
+
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, errors.NewInvalidCredentialsError("basic")
+	}
+
+	if !verifyPassword(user.hash, password) {
+		return nil, errors.NewInvalidCredentialsError("basic")
+	}
+
+	claims := &jwt.JWTClaims{Role: user.role, Authorities: user.authorities}
+	claims.Subject = username
+
+	return claims, nil
+}
+
+func parseHTPasswd(data []byte) (map[string]htpasswdUser, error) {
+	users := map[string]htpasswdUser{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(text, ":", 4)
+		if len(fields) < 2 || len(fields[0]) == 0 {
+			return nil, fmt.Errorf("line %d: expected user:hash", line)
+		}
+		if !isSupportedHash(fields[1]) {
+			return nil, fmt.Errorf("line %d: unsupported hash for user %q", line, fields[0])
+		}
+		if _, ok := users[fields[0]]; ok {
+			return nil, fmt.Errorf("line %d: duplicate user %q", line, fields[0])
+		}
+
+		user := htpasswdUser{hash: fields[1]}
+		if len(fields) > 2 {
+			user.role = fields[2]
+		}
+		if len(fields) > 3 {
+			user.authorities = splitList(fields[3])
+		}
+		users[fields[0]] = user
+	}
+
+	return users, scanner.Err()
+}
+
+func isSupportedHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$argon2id$", "$argon2i$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func verifyPassword(hash string, password string) bool {
+	if strings.HasPrefix(hash, "$argon2") {
+		return verifyArgon2(hash, password)
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// verifyArgon2 checks a password against a hash in the PHC string format,
+// e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+func verifyArgon2(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+
+	var actual []byte
+	switch parts[1] {
+	case "argon2id":
+		actual = argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(expected)))
+	case "argon2i":
+		actual = argon2.Key([]byte(password), salt, iterations, memory, threads, uint32(len(expected)))
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(actual, expected) == 1
+}
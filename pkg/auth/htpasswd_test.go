@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+
+	"github.com/team-xquare/contour-middleware/pkg/errors"
+)
+
+// bcryptSecret is the bcrypt hash of "secret" with the minimum cost.
+const bcryptSecret = "$2a$04$HmJ4wKLNtdJyMztRIrCdM.d/lKxh2JIKUklrYJAkfkdRRpJJzET.W"
+
+func argon2idHash(password string) string {
+	salt := []byte("0123456789abcdef")
+	hash := argon2.IDKey([]byte(password), salt, 1, 1024, 1, 32)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s",
+		argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	)
+}
+
+func prepareHTPasswd(t *testing.T, content string) (*HTPasswd, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	h, err := LoadHTPasswd(path)
+	assert.NoError(t, err)
+
+	return h, path
+}
+
+func TestHTPasswdAuthenticate(t *testing.T) {
+	h, _ := prepareHTPasswd(t, "# machine clients\n"+
+		"legacy:"+bcryptSecret+":SCH:auth-1,auth-2\n"+
+		"batch:"+argon2idHash("batch-secret")+"\n")
+
+	claims, err := h.Authenticate("legacy", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy", claims.Subject)
+	assert.Equal(t, "SCH", claims.Role)
+	assert.Equal(t, []string{"auth-1", "auth-2"}, claims.Authorities)
+
+	claims, err = h.Authenticate("batch", "batch-secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "batch", claims.Subject)
+
+	_, err = h.Authenticate("legacy", "wrong")
+	assert.IsType(t, errors.InvalidCredentialsError{}, err)
+
+	_, err = h.Authenticate("batch", "wrong")
+	assert.IsType(t, errors.InvalidCredentialsError{}, err)
+
+	_, err = h.Authenticate("unknown", "secret")
+	assert.IsType(t, errors.InvalidCredentialsError{}, err)
+}
+
+func TestHTPasswdReload(t *testing.T) {
+	h, path := prepareHTPasswd(t, "legacy:"+bcryptSecret+"\n")
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("legacy:plaintext\n"), 0600))
+	assert.Error(t, h.Reload())
+
+	_, err := h.Authenticate("legacy", "secret")
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("other:"+bcryptSecret+"\n"), 0600))
+	assert.NoError(t, h.Reload())
+
+	_, err = h.Authenticate("legacy", "secret")
+	assert.Error(t, err)
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/team-xquare/contour-middleware/pkg/errors"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+// Policy describes who may reach the requests it matches. A request matches
+// when its host, path and method all match; empty matchers match anything.
+type Policy struct {
+	Name string `yaml:"name"`
+
+	// Host is either an exact host name or a wildcard such as
+	// "*.xquare.app". The port of the request host is ignored.
+	Host       string   `yaml:"host"`
+	PathPrefix string   `yaml:"pathPrefix"`
+	PathRegex  string   `yaml:"pathRegex"`
+	Methods    []string `yaml:"methods"`
+
+	// Roles lists the roles of which the user must have one.
+	Roles []string `yaml:"roles"`
+	// Authorities lists the authorities the user must all have.
+	Authorities []string `yaml:"authorities"`
+
+	pathRegex *regexp.Regexp
+}
+
+// Policies are evaluated in order and the first matching policy decides.
+type Policies []Policy
+
+// NewPolicies validates the policies and compiles their path expressions.
+func NewPolicies(policies []Policy) (Policies, error) {
+	result := make(Policies, len(policies))
+	for i, p := range policies {
+		if len(p.Name) == 0 {
+			p.Name = fmt.Sprintf("#%d", i)
+		}
+
+		if len(p.PathRegex) != 0 {
+			re, err := regexp.Compile(p.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+			}
+			p.pathRegex = re
+		}
+
+		for _, m := range p.Methods {
+			if len(m) == 0 || strings.ContainsAny(m, " \t") {
+				return nil, fmt.Errorf("policy %s: invalid method %q", p.Name, m)
+			}
+		}
+
+		result[i] = p
+	}
+
+	return result, nil
+}
+
+// LoadPolicies reads a YAML list of Policy from path.
+func LoadPolicies(path string) (Policies, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []Policy
+	if err := yaml.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("invalid policies %s: %w", path, err)
+	}
+
+	result, err := NewPolicies(policies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policies %s: %w", path, err)
+	}
+
+	return result, nil
+}
+
+// Match returns the first policy matching the request, or nil.
+func (p Policies) Match(r *http.Request) *Policy {
+	for i := range p {
+		if p[i].matches(r) {
+			return &p[i]
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) matches(r *http.Request) bool {
+	if len(p.Host) != 0 && !matchHost(p.Host, r.URL.Host) {
+		return false
+	}
+	if len(p.PathPrefix) != 0 && !strings.HasPrefix(r.URL.Path, p.PathPrefix) {
+		return false
+	}
+	if p.pathRegex != nil && !p.pathRegex.MatchString(r.URL.Path) {
+		return false
+	}
+	if len(p.Methods) != 0 {
+		for _, m := range p.Methods {
+			if strings.EqualFold(m, r.Method) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func matchHost(pattern string, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(pattern[1:]))
+	}
+
+	return strings.EqualFold(pattern, host)
+}
+
+// RequiresIdentity reports whether the policy can only be satisfied by an
+// authenticated user.
+func (p *Policy) RequiresIdentity() bool {
+	return len(p.Roles) != 0 || len(p.Authorities) != 0
+}
+
+// Authorize checks that the claims satisfy the role and authority
+// requirements of the policy.
+func (p *Policy) Authorize(claims *jwt.JWTClaims) error {
+	if len(p.Roles) != 0 && !contains(p.Roles, claims.Role) {
+		return errors.NewForbiddenError(p.Name, fmt.Sprintf("role %q is not one of %s", claims.Role, strings.Join(p.Roles, ", ")))
+	}
+
+	for _, authority := range p.Authorities {
+		if !contains(claims.Authorities, authority) {
+			return errors.NewForbiddenError(p.Name, fmt.Sprintf("missing authority %q", authority))
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/team-xquare/contour-middleware/pkg/errors"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+func preparePolicies(t *testing.T) Policies {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+- name: public-feed
+  host: feed.xquare.app
+  pathPrefix: /feeds
+  methods: [GET]
+- name: feed-admin
+  host: "*.xquare.app"
+  pathRegex: ^/feeds(/.*)?$
+  roles: [SCH]
+  authorities: [FEED_WRITE]
+- name: students
+  pathPrefix: /students
+  roles: [STU, SCH]
+`), 0600))
+
+	policies, err := LoadPolicies(path)
+	assert.NoError(t, err)
+
+	return policies
+}
+
+func TestPolicyMatch(t *testing.T) {
+	policies := preparePolicies(t)
+
+	match := func(method string, host string, path string) string {
+		p := policies.Match(&http.Request{Method: method, URL: &url.URL{Host: host, Path: path}})
+		if p == nil {
+			return ""
+		}
+		return p.Name
+	}
+
+	assert.Equal(t, "public-feed", match("GET", "feed.xquare.app", "/feeds/1"))
+	assert.Equal(t, "public-feed", match("get", "feed.xquare.app:443", "/feeds"))
+	assert.Equal(t, "feed-admin", match("POST", "feed.xquare.app", "/feeds/1"))
+	assert.Equal(t, "feed-admin", match("GET", "api.xquare.app", "/feeds"))
+	assert.Equal(t, "students", match("GET", "api.xquare.app", "/students/me"))
+	assert.Equal(t, "", match("GET", "api.xquare.app", "/feedsx"))
+}
+
+func TestPolicyAuthorize(t *testing.T) {
+	policies := preparePolicies(t)
+	policy := policies.Match(&http.Request{Method: "POST", URL: &url.URL{Host: "feed.xquare.app", Path: "/feeds"}})
+
+	assert.True(t, policy.RequiresIdentity())
+	assert.NoError(t, policy.Authorize(&jwt.JWTClaims{Role: "SCH", Authorities: []string{"FEED_READ", "FEED_WRITE"}}))
+	assert.IsType(t, errors.ForbiddenError{}, policy.Authorize(&jwt.JWTClaims{Role: "STU", Authorities: []string{"FEED_WRITE"}}))
+	assert.IsType(t, errors.ForbiddenError{}, policy.Authorize(&jwt.JWTClaims{Role: "SCH"}))
+}
+
+func TestInvalidPolicies(t *testing.T) {
+	_, err := NewPolicies([]Policy{{Name: "broken", PathRegex: "("}})
+	assert.Error(t, err)
+
+	_, err = NewPolicies([]Policy{{Name: "broken", Methods: []string{""}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Context extension keys through which an HTTPProxy declares the auth
+// requirements of its routes.
+const (
+	contextKeyAuthMode            = "auth-mode"
+	contextKeyRequiredRole        = "required-role"
+	contextKeyRequiredAuthorities = "required-authorities"
+)
+
+type AuthMode string
+
+const (
+	// AuthModeOptional verifies credentials when present but lets
+	// anonymous requests through.
+	AuthModeOptional AuthMode = "optional"
+	// AuthModeRequired denies requests without valid credentials.
+	AuthModeRequired AuthMode = "required"
+	// AuthModeNone skips authentication entirely.
+	AuthModeNone AuthMode = "none"
+	// AuthModeRequiredExceptAllowlisted behaves as required, except for
+	// allowlisted paths which behave as optional.
+	AuthModeRequiredExceptAllowlisted AuthMode = "required-except-allowlisted-paths"
+)
+
+func ParseAuthMode(s string) (AuthMode, error) {
+	switch mode := AuthMode(s); mode {
+	case AuthModeOptional, AuthModeRequired, AuthModeNone, AuthModeRequiredExceptAllowlisted:
+		return mode, nil
+	}
+
+	return "", fmt.Errorf("invalid auth mode %q", s)
+}
+
+// authMode returns the mode requested by the route, falling back to the
+// configured default, with allowlisted paths resolved to optional.
+func (c *checkService) authMode(request *Request) (AuthMode, error) {
+	mode := c.mode
+	if value, ok := request.Context[contextKeyAuthMode]; ok {
+		var err error
+		if mode, err = ParseAuthMode(value); err != nil {
+			return "", err
+		}
+	}
+
+	if mode == AuthModeRequiredExceptAllowlisted {
+		if c.isAllowlisted(request.Request.URL.Path) {
+			return AuthModeOptional, nil
+		}
+		return AuthModeRequired, nil
+	}
+
+	return mode, nil
+}
+
+func (c *checkService) isAllowlisted(path string) bool {
+	for _, p := range c.allowlist {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPolicies returns the configured policy matching the request along
+// with the policy declared by the route's context extensions.
+func (c *checkService) matchPolicies(request *Request) []*Policy {
+	var policies []*Policy
+
+	if policy := c.policies.Match(&request.Request); policy != nil {
+		policies = append(policies, policy)
+	}
+
+	if policy := contextPolicy(request.Context); policy != nil {
+		policies = append(policies, policy)
+	}
+
+	return policies
+}
+
+func contextPolicy(context map[string]string) *Policy {
+	roles := splitList(context[contextKeyRequiredRole])
+	authorities := splitList(context[contextKeyRequiredAuthorities])
+	if len(roles) == 0 && len(authorities) == 0 {
+		return nil
+	}
+
+	return &Policy{Name: "context-extensions", Roles: roles, Authorities: authorities}
+}
+
+// identityPolicy returns the first policy that can only be satisfied by an
+// authenticated user.
+func identityPolicy(policies []*Policy) *Policy {
+	for _, p := range policies {
+		if p.RequiresIdentity() {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// splitList splits a comma or space separated list.
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
@@ -15,15 +15,16 @@ package auth
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"io/ioutil"
 	"net"
+	"strconv"
+	"time"
 
 	envoy_service_auth_v2 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2"
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
+
+	"github.com/team-xquare/contour-middleware/pkg/metrics"
 )
 
 type CheckRequestV2 = envoy_service_auth_v2.CheckRequest   //nolint(golint)
@@ -31,21 +32,28 @@ type CheckResponseV2 = envoy_service_auth_v2.CheckResponse //nolint(golint)
 type CheckRequestV3 = envoy_service_auth_v3.CheckRequest   //nolint(golint)
 type CheckResponseV3 = envoy_service_auth_v3.CheckResponse //nolint(golint)
 
+// ServiceNames are the gRPC services registered by RegisterServer.
+var ServiceNames = []string{
+	"envoy.service.auth.v2.Authorization",
+	"envoy.service.auth.v3.Authorization",
+}
+
 type authV2 struct {
 	checkService CheckService
 }
 
 func (a *authV2) Check(ctx context.Context, check *CheckRequestV2) (*CheckResponseV2, error) {
+	start := time.Now()
+
 	request := Request{}
 	request.FromV2(check)
 
 	response, err := a.checkService.Check(ctx, &request)
-	if err != nil {
+	observeCheck("v2", start, response, err)
+	if response == nil {
 		return nil, err
 	}
 
-	response.Response.Header.Set("TETE", "ETETE")
-
 	return response.AsV2(), nil
 }
 
@@ -54,17 +62,34 @@ type authV3 struct {
 }
 
 func (a *authV3) Check(ctx context.Context, check *CheckRequestV3) (*CheckResponseV3, error) {
+	start := time.Now()
+
 	request := Request{}
 	request.FromV3(check)
 
 	response, err := a.checkService.Check(ctx, &request)
-	if err != nil {
+	observeCheck("v3", start, response, err)
+	if response == nil {
 		return nil, err
 	}
 
 	return response.AsV3(), nil
 }
 
+func observeCheck(api string, start time.Time, response *Response, err error) {
+	metrics.CheckDuration.WithLabelValues(api).Observe(time.Since(start).Seconds())
+
+	decision, status, reason := "error", "", denialReason(err)
+	if response != nil {
+		decision, status = "deny", strconv.Itoa(response.Response.StatusCode)
+		if response.Allow {
+			decision, reason = "allow", ""
+		}
+	}
+
+	metrics.CheckDecisions.WithLabelValues(api, decision, status, reason).Inc()
+}
+
 func RegisterServer(srv *grpc.Server, c CheckService) {
 	v2 := &authV2{checkService: c}
 	v3 := &authV3{checkService: c}
@@ -73,34 +98,43 @@ func RegisterServer(srv *grpc.Server, c CheckService) {
 	envoy_service_auth_v3.RegisterAuthorizationServer(srv, v3)
 }
 
-func RunServer(listener net.Listener, srv *grpc.Server) error {
-	errChan := make(chan error)
+// RunServer serves srv on listener until ctx is done, then stops it with
+// StopServer.
+func RunServer(ctx context.Context, listener net.Listener, srv *grpc.Server, drainTimeout time.Duration) error {
+	errChan := make(chan error, 1)
 
 	go func() {
 		errChan <- srv.Serve(listener)
 	}()
 
-	err := <-errChan
-	return err
-}
-
-func NewServerCredentials(certPath string, keyPath string, caPath string) (credentials.TransportCredentials, error) {
-	srv, err := tls.LoadX509KeyPair(certPath, keyPath)
-	if err != nil {
-		return nil, err
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
 	}
 
-	p := x509.NewCertPool()
-
-	ca, err := ioutil.ReadFile(caPath)
-	if err != nil {
-		return nil, err
+	StopServer(srv, drainTimeout)
+	if err := <-errChan; err != grpc.ErrServerStopped {
+		return err
 	}
 
-	p.AppendCertsFromPEM(ca)
+	return nil
+}
 
-	return credentials.NewTLS(&tls.Config{
-		Certificates: []tls.Certificate{srv},
-		RootCAs:      p,
-	}), nil
+// StopServer stops accepting connections and waits at most drainTimeout
+// for in-flight calls to complete before closing the remaining
+// connections.
+func StopServer(srv *grpc.Server, drainTimeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+		logrus.Warnf("in-flight calls did not complete within %s, closing connections", drainTimeout)
+		srv.Stop()
+	}
 }
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestRunServerStopsOnCancel(t *testing.T) {
+	srv := grpc.NewServer()
+	RegisterServer(srv, prepareCheckService())
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- RunServer(ctx, bufconn.Listen(1<<20), srv, time.Second)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-errChan:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+}
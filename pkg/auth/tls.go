@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+
+	"github.com/team-xquare/contour-middleware/pkg/watch"
+)
+
+// ServerCertificates holds the server certificate of the authentication
+// endpoint and the CA bundle its clients are verified with. They are
+// handed out per connection, so a reload takes effect for new connections
+// without a restart.
+type ServerCertificates struct {
+	certPath string
+	keyPath  string
+	caPath   string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	ca   *x509.CertPool
+}
+
+func LoadServerCertificates(certPath string, keyPath string, caPath string) (*ServerCertificates, error) {
+	c := &ServerCertificates{certPath: certPath, keyPath: keyPath, caPath: caPath}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reload re-reads the certificate, key and CA bundle.
+func (c *ServerCertificates) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(c.caPath)
+	if err != nil {
+		return err
+	}
+
+	ca := x509.NewCertPool()
+	if !ca.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in %s", c.caPath)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.ca = ca
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the certificates whenever one of their files changes,
+// until ctx is done.
+func (c *ServerCertificates) Watch(ctx context.Context, interval time.Duration) {
+	watch.Reload(ctx, interval, "TLS certificates", c.Reload, c.certPath, c.keyPath, c.caPath)
+}
+
+// GetCertificate returns the current server certificate.
+func (c *ServerCertificates) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// ClientVerification describes how the certificates of clients are
+// verified against the CA bundle.
+type ClientVerification struct {
+	Mode tls.ClientAuthType
+
+	// AllowedNames, if set, lists the DNS or URI SANs and common names a
+	// client certificate must carry one of. Clients without a certificate
+	// are then refused in every mode.
+	AllowedNames []string
+}
+
+// ParseClientAuth parses the client certificate mode: "none",
+// "verify-if-given" or "require".
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case "none":
+		return tls.NoClientCert, nil
+	case "verify-if-given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+
+	return tls.NoClientCert, fmt.Errorf("invalid client certificate mode %q", s)
+}
+
+func (v ClientVerification) verifyPeerCertificate(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+	if len(v.AllowedNames) == 0 {
+		return nil
+	}
+	// Without a certificate there is no name to allow, even when the mode
+	// lets clients omit it.
+	if len(chains) == 0 {
+		return errors.New("client certificate required by the allowed client names")
+	}
+
+	leaf := chains[0][0]
+	names := append([]string{leaf.Subject.CommonName}, leaf.DNSNames...)
+	for _, uri := range leaf.URIs {
+		names = append(names, uri.String())
+	}
+
+	for _, name := range names {
+		if contains(v.AllowedNames, name) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("client certificate %q is not allowed", leaf.Subject.CommonName)
+}
+
+func (c *ServerCertificates) config(v ClientVerification) *tls.Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &tls.Config{
+		GetCertificate:        c.GetCertificate,
+		ClientCAs:             c.ca,
+		ClientAuth:            v.Mode,
+		VerifyPeerCertificate: v.verifyPeerCertificate,
+		NextProtos:            []string{"h2"},
+	}
+}
+
+// NewServerCredentials returns the credentials of a server using the
+// current certificates of c for every new connection, and verifying
+// clients as described by v.
+func NewServerCredentials(c *ServerCertificates, v ClientVerification) credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return c.config(v), nil
+		},
+	})
+}
+
+// NewClientCredentials returns the credentials used to reach a server
+// whose certificate is signed by the CA at caPath. The client certificate
+// is optional.
+func NewClientCredentials(certPath string, keyPath string, caPath string) (credentials.TransportCredentials, error) {
+	config := &tls.Config{}
+
+	if len(certPath) != 0 || len(keyPath) != 0 {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	ca, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config.RootCAs = x509.NewCertPool()
+	config.RootCAs.AppendCertsFromPEM(ca)
+
+	return credentials.NewTLS(config), nil
+}
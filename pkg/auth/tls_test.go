@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/credentials"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCertificate issues a certificate for name, signed by parent or
+// self-signed when parent is nil.
+func newTestCertificate(t *testing.T, name string, parent *testCertificate, dnsNames ...string) *testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              dnsNames,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	assert.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testCertificate{cert: cert, key: key}
+}
+
+func (c *testCertificate) write(t *testing.T, certPath string, keyPath string) {
+	t.Helper()
+
+	assert.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+
+	if len(keyPath) != 0 {
+		der, err := x509.MarshalECPrivateKey(c.key)
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	}
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+// handshake connects to a server using creds and returns the common name
+// of the server certificate, or the error of either side.
+func handshake(t *testing.T, creds credentials.TransportCredentials, client *tls.Config) (string, error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+
+		_, _, err = creds.ServerHandshake(conn)
+		errChan <- err
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), client)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err := <-errChan; err != nil {
+		return "", err
+	}
+
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestServerCertificatesReload(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	caPath := filepath.Join(dir, "ca.crt")
+
+	ca := newTestCertificate(t, "ca", nil)
+	ca.write(t, caPath, "")
+	newTestCertificate(t, "old", ca, "localhost").write(t, certPath, keyPath)
+
+	certificates, err := LoadServerCertificates(certPath, keyPath, caPath)
+	assert.NoError(t, err)
+
+	config := certificates.config(ClientVerification{})
+	cert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, "old", commonName(t, cert))
+
+	newTestCertificate(t, "new", ca, "localhost").write(t, certPath, keyPath)
+	assert.NoError(t, certificates.Reload())
+
+	cert, err = config.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", commonName(t, cert))
+
+	// A key that does not match the certificate keeps the current one.
+	newTestCertificate(t, "broken", ca, "localhost").write(t, certPath, "")
+	assert.Error(t, certificates.Reload())
+
+	cert, err = config.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", commonName(t, cert))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	name, err := handshake(t, NewServerCredentials(certificates, ClientVerification{}), &tls.Config{ServerName: "localhost", RootCAs: roots})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", name)
+}
+
+func TestServerCredentialsClientVerification(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	caPath := filepath.Join(dir, "ca.crt")
+
+	ca := newTestCertificate(t, "ca", nil)
+	ca.write(t, caPath, "")
+	newTestCertificate(t, "server", ca, "localhost").write(t, certPath, keyPath)
+
+	certificates, err := LoadServerCertificates(certPath, keyPath, caPath)
+	assert.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	clientConfig := func(cert *testCertificate) *tls.Config {
+		config := &tls.Config{ServerName: "localhost", RootCAs: roots}
+		if cert != nil {
+			// Send the certificate even when the server does not accept
+			// its issuer.
+			config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &tls.Certificate{Certificate: [][]byte{cert.cert.Raw}, PrivateKey: cert.key}, nil
+			}
+		}
+		return config
+	}
+
+	envoy := newTestCertificate(t, "envoy", ca, "envoy.projectcontour")
+	other := newTestCertificate(t, "other", ca, "other.default")
+	untrusted := newTestCertificate(t, "envoy", newTestCertificate(t, "other-ca", nil), "envoy.projectcontour")
+
+	creds := NewServerCredentials(certificates, ClientVerification{
+		Mode:         tls.RequireAndVerifyClientCert,
+		AllowedNames: []string{"envoy.projectcontour"},
+	})
+
+	for _, tt := range []struct {
+		cert    *testCertificate
+		allowed bool
+	}{
+		{envoy, true},
+		{other, false},
+		{untrusted, false},
+		{nil, false},
+	} {
+		_, err := handshake(t, creds, clientConfig(tt.cert))
+		assert.Equal(t, tt.allowed, err == nil, tt.cert)
+	}
+
+	creds = NewServerCredentials(certificates, ClientVerification{
+		Mode:         tls.VerifyClientCertIfGiven,
+		AllowedNames: []string{"envoy.projectcontour"},
+	})
+
+	for _, tt := range []struct {
+		cert    *testCertificate
+		allowed bool
+	}{
+		{envoy, true},
+		{other, false},
+		{nil, false},
+	} {
+		_, err := handshake(t, creds, clientConfig(tt.cert))
+		assert.Equal(t, tt.allowed, err == nil, tt.cert)
+	}
+
+	creds = NewServerCredentials(certificates, ClientVerification{Mode: tls.VerifyClientCertIfGiven})
+
+	_, err = handshake(t, creds, clientConfig(nil))
+	assert.NoError(t, err)
+	_, err = handshake(t, creds, clientConfig(untrusted))
+	assert.Error(t, err)
+}
+
+func TestParseClientAuth(t *testing.T) {
+	mode, err := ParseClientAuth("require")
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, mode)
+
+	_, err = ParseClientAuth("request")
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/team-xquare/contour-middleware/pkg/admin"
+	"github.com/team-xquare/contour-middleware/pkg/auth"
+)
+
+func NewAdminCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "admin",
+		Short: "Manage token revocation on a running authentication server",
+		Long: `Manage token revocation on a running authentication server.
+
+The replica that receives a change writes it to the files of its
+--revocations-path and --not-before-path. Every replica watches these
+files, so they must be on a volume the replicas share, and the change
+applies to all of them within their --watch-interval.`,
+	}
+
+	cmd.PersistentFlags().String("address", "localhost:9444", "The address of the admin API; unix:///path for a Unix socket.")
+	cmd.PersistentFlags().Bool("insecure", false, "Connect without TLS, to a server run with --insecure.")
+	cmd.PersistentFlags().String("tls-ca-path", "/tls/ca.crt", "Path to the CA certificate bundle the admin API certificate is verified with.")
+	cmd.PersistentFlags().String("tls-cert-path", "", "Path to the client certificate, if the admin API requires one.")
+	cmd.PersistentFlags().String("tls-key-path", "", "Path to the client key.")
+
+	cmd.AddCommand(Defaults(newAdminRevokeCommand()))
+	cmd.AddCommand(Defaults(newAdminNotBeforeCommand()))
+	cmd.AddCommand(Defaults(newAdminListCommand()))
+
+	return &cmd
+}
+
+func newAdminRevokeCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "revoke [OPTIONS]",
+		Short: "Revoke a token by its jti, or every token of a subject",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, conn, err := dialAdmin(cmd)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			request, err := structpb.NewStruct(map[string]interface{}{
+				"jti":        mustString(cmd.Flags().GetString("jti")),
+				"subject":    mustString(cmd.Flags().GetString("subject")),
+				"expires_at": mustString(cmd.Flags().GetString("expires-at")),
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = client.Revoke(cmd.Context(), request)
+			return err
+		},
+	}
+
+	cmd.Flags().String("jti", "", "Token id to revoke.")
+	cmd.Flags().String("subject", "", "Subject whose tokens are revoked.")
+	cmd.Flags().String("expires-at", "", "RFC 3339 time after which the revocation is dropped, normally the exp of the token.")
+
+	return &cmd
+}
+
+func newAdminNotBeforeCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "not-before SUBJECT [OPTIONS]",
+		Short: "Invalidate every token of a subject issued before a time",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, conn, err := dialAdmin(cmd)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			request, err := structpb.NewStruct(map[string]interface{}{
+				"subject":    args[0],
+				"not_before": mustString(cmd.Flags().GetString("time")),
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = client.SetNotBefore(cmd.Context(), request)
+			return err
+		},
+	}
+
+	cmd.Flags().String("time", "", "RFC 3339 time before which tokens are invalid; defaults to now.")
+
+	return &cmd
+}
+
+func newAdminListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Print the revoked tokens and subjects as JSON",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, conn, err := dialAdmin(cmd)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			revocations, err := client.ListRevocations(cmd.Context(), &emptypb.Empty{})
+			if err != nil {
+				return err
+			}
+
+			notBefore, err := client.ListNotBefore(cmd.Context(), &emptypb.Empty{})
+			if err != nil {
+				return err
+			}
+
+			result := revocations.AsMap()
+			for key, value := range notBefore.AsMap() {
+				result[key] = value
+			}
+
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(result)
+		},
+	}
+}
+
+func dialAdmin(cmd *cobra.Command) (*admin.AdminClient, *grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if !mustBool(cmd.Flags().GetBool("insecure")) {
+		var err error
+		creds, err = auth.NewClientCredentials(
+			mustString(cmd.Flags().GetString("tls-cert-path")),
+			mustString(cmd.Flags().GetString("tls-key-path")),
+			mustString(cmd.Flags().GetString("tls-ca-path")),
+		)
+		if err != nil {
+			return nil, nil, ExitErrorf(EX_CONFIG, "invalid TLS configuration: %s", err)
+		}
+	}
+
+	conn, err := grpc.DialContext(cmd.Context(), mustString(cmd.Flags().GetString("address")), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to the admin API: %w", err)
+	}
+
+	return admin.NewAdminClient(conn), conn, nil
+}
@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/team-xquare/contour-middleware/pkg/auth"
+	"github.com/team-xquare/contour-middleware/pkg/config"
+)
+
+// checkRequest is the JSON form of a simulated request given with
+// --request-file.
+type checkRequest struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	Cookies   map[string]string `json:"cookies"`
+	Context   map[string]string `json:"context"`
+	Principal string            `json:"principal"`
+}
+
+func NewCheckCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "check [OPTIONS]",
+		Short: "Decide on a request offline, as the authentication server would",
+		Long: `Decide on a request offline, as the authentication server would.
+
+The request is run through the check service built from the same config
+file, environment and flags as ` + "`auth run`" + `, without Envoy. The
+request is read from --request-file, if given, and completed or overridden
+by the other flags. The command fails when the request would be denied.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := config.Load(mustString(cmd.Flags().GetString("config")), cmd.Flags()); err != nil {
+				return ExitError{EX_CONFIG, err}
+			}
+
+			request, err := simulatedRequest(cmd)
+			if err != nil {
+				return ExitError{EX_USAGE, err}
+			}
+
+			// Denials of simulated requests are not worth reporting.
+			sentry.CurrentHub().BindClient(nil)
+
+			log := logrus.New()
+			log.SetLevel(logrus.WarnLevel)
+
+			parser, err := DefaultParser(cmd)
+			if err != nil {
+				return ExitErrorf(EX_CONFIG, "invalid JWT configuration: %s", err)
+			}
+
+			check, err := DefaultCheckService(cmd, log, parser)
+			if err != nil {
+				return ExitError{EX_CONFIG, err}
+			}
+
+			response, err := check.Check(cmd.Context(), request)
+			printDecision(cmd.OutOrStdout(), response, err)
+
+			if !response.Allow {
+				return ExitErrorf(EX_FAIL, "request would be denied with %d", response.Response.StatusCode)
+			}
+
+			return nil
+		},
+	}
+
+	addRunFlags(cmd.Flags())
+
+	cmd.Flags().String("request-file", "", "Path to a JSON request with method, url, headers, cookies, context and principal.")
+	cmd.Flags().String("method", "", "Method of the request; defaults to GET.")
+	cmd.Flags().String("url", "", "URL of the request, e.g. https://api.xquare.app/users?page=1.")
+	cmd.Flags().StringArrayP("header", "H", nil, "Request header as \"Name: value\". May be repeated.")
+	cmd.Flags().StringArray("cookie", nil, "Request cookie as NAME=VALUE. May be repeated.")
+	cmd.Flags().StringArray("context", nil, "Context extension of the route as KEY=VALUE, e.g. auth-mode=required. May be repeated.")
+	cmd.Flags().String("principal", "", "Principal of the client certificate Envoy verified, for the mtls authenticator.")
+
+	return &cmd
+}
+
+func simulatedRequest(cmd *cobra.Command) (*auth.Request, error) {
+	var r checkRequest
+	if path := mustString(cmd.Flags().GetString("request-file")); len(path) != 0 {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("invalid request %s: %w", path, err)
+		}
+	}
+
+	if method := mustString(cmd.Flags().GetString("method")); len(method) != 0 {
+		r.Method = method
+	}
+	if len(r.Method) == 0 {
+		r.Method = http.MethodGet
+	}
+	if u := mustString(cmd.Flags().GetString("url")); len(u) != 0 {
+		r.URL = u
+	}
+	if principal := mustString(cmd.Flags().GetString("principal")); len(principal) != 0 {
+		r.Principal = principal
+	}
+
+	if len(r.URL) == 0 {
+		return nil, fmt.Errorf("no request URL given")
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request URL: %w", err)
+	}
+
+	request := &auth.Request{
+		ID:      uuid.NewString(),
+		Context: map[string]string{},
+		Request: http.Request{
+			URL:    u,
+			Host:   u.Host,
+			Header: http.Header{},
+			Method: strings.ToUpper(r.Method),
+			Proto:  "HTTP/1.1",
+		},
+		Principal: r.Principal,
+	}
+
+	for name, value := range r.Headers {
+		request.Request.Header.Set(name, value)
+	}
+	for _, header := range mustStringArray(cmd.Flags().GetStringArray("header")) {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			return nil, fmt.Errorf("invalid header %q: expected \"Name: value\"", header)
+		}
+		request.Request.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	for name, value := range r.Cookies {
+		request.Request.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	for _, cookie := range mustStringArray(cmd.Flags().GetStringArray("cookie")) {
+		parts := strings.SplitN(cookie, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("invalid cookie %q: expected NAME=VALUE", cookie)
+		}
+		request.Request.AddCookie(&http.Cookie{Name: parts[0], Value: parts[1]})
+	}
+
+	for key, value := range r.Context {
+		request.Context[key] = value
+	}
+	for _, extension := range mustStringArray(cmd.Flags().GetStringArray("context")) {
+		parts := strings.SplitN(extension, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("invalid context extension %q: expected KEY=VALUE", extension)
+		}
+		request.Context[parts[0]] = parts[1]
+	}
+
+	return request, nil
+}
+
+func printDecision(w io.Writer, response *auth.Response, err error) {
+	decision := "deny"
+	if response.Allow {
+		decision = "allow"
+	}
+
+	fmt.Fprintf(w, "Decision:    %s\n", decision)
+	fmt.Fprintf(w, "Status:      %d %s\n", response.Response.StatusCode, http.StatusText(response.Response.StatusCode))
+	fmt.Fprintf(w, "Decided by:  %s\n", response.DecidedBy)
+	if err != nil {
+		fmt.Fprintf(w, "Error:       %s\n", err)
+	}
+
+	if len(response.Response.Header) != 0 {
+		fmt.Fprintln(w, "Headers:")
+		printHeaders(w, response.Response.Header)
+	}
+
+	if response.Response.Body != nil {
+		if body, _ := ioutil.ReadAll(response.Response.Body); len(body) != 0 {
+			fmt.Fprintf(w, "Body:        %s\n", body)
+		}
+	}
+}
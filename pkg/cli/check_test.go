@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatedRequest(t *testing.T) {
+	requestFile := filepath.Join(t.TempDir(), "request.json")
+	assert.NoError(t, ioutil.WriteFile(requestFile, []byte(`{
+  "method": "post",
+  "url": "https://api.xquare.app/feed?page=2",
+  "headers": {"authorization": "Bearer file", "user-agent": "curl"},
+  "cookies": {"accessToken": "file"},
+  "context": {"auth-mode": "optional", "required-role": "STU"},
+  "principal": "spiffe://xquare/file"
+}`), 0600))
+
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		method    string
+		url       url.URL
+		header    http.Header
+		context   map[string]string
+		principal string
+		err       string
+	}{
+		{
+			name:    "url",
+			args:    []string{"--url", "https://api.xquare.app/users/1?page=2&size=10"},
+			method:  "GET",
+			url:     url.URL{Scheme: "https", Host: "api.xquare.app", Path: "/users/1", RawQuery: "page=2&size=10"},
+			header:  http.Header{},
+			context: map[string]string{},
+		},
+		{
+			name: "headers, cookies and context",
+			args: []string{
+				"--url", "http://localhost:8080/", "--method", "delete",
+				"-H", "Authorization: Bearer a:b", "--header", "x-api-key:  key ",
+				"--cookie", "accessToken=a=b", "--cookie", "theme=dark",
+				"--context", "auth-mode=required", "--context", "required-authorities=A B",
+				"--principal", "spiffe://xquare/batch",
+			},
+			method: "DELETE",
+			url:    url.URL{Scheme: "http", Host: "localhost:8080", Path: "/"},
+			header: http.Header{
+				"Authorization": {"Bearer a:b"},
+				"X-Api-Key":     {"key"},
+				"Cookie":        {"accessToken=a=b; theme=dark"},
+			},
+			context:   map[string]string{"auth-mode": "required", "required-authorities": "A B"},
+			principal: "spiffe://xquare/batch",
+		},
+		{
+			name:   "request file",
+			args:   []string{"--request-file", requestFile},
+			method: "POST",
+			url:    url.URL{Scheme: "https", Host: "api.xquare.app", Path: "/feed", RawQuery: "page=2"},
+			header: http.Header{
+				"Authorization": {"Bearer file"},
+				"User-Agent":    {"curl"},
+				"Cookie":        {"accessToken=file"},
+			},
+			context:   map[string]string{"auth-mode": "optional", "required-role": "STU"},
+			principal: "spiffe://xquare/file",
+		},
+		{
+			name: "flags override the request file",
+			args: []string{
+				"--request-file", requestFile, "--method", "PUT", "--url", "https://api.xquare.app/other",
+				"-H", "Authorization: Bearer flag", "--context", "auth-mode=required",
+			},
+			method: "PUT",
+			url:    url.URL{Scheme: "https", Host: "api.xquare.app", Path: "/other"},
+			header: http.Header{
+				"Authorization": {"Bearer flag"},
+				"User-Agent":    {"curl"},
+				"Cookie":        {"accessToken=file"},
+			},
+			context:   map[string]string{"auth-mode": "required", "required-role": "STU"},
+			principal: "spiffe://xquare/file",
+		},
+		{name: "no url", err: "no request URL given"},
+		{name: "invalid url", args: []string{"--url", "https://api.xquare.app/%zz"}, err: `invalid request URL: parse "https://api.xquare.app/%zz": invalid URL escape "%zz"`},
+		{name: "invalid header", args: []string{"--url", "/", "-H", "Authorization"}, err: `invalid header "Authorization": expected "Name: value"`},
+		{name: "invalid cookie", args: []string{"--url", "/", "--cookie", "accessToken"}, err: `invalid cookie "accessToken": expected NAME=VALUE`},
+		{name: "invalid context", args: []string{"--url", "/", "--context", "=required"}, err: `invalid context extension "=required": expected KEY=VALUE`},
+		{name: "missing request file", args: []string{"--request-file", filepath.Join(t.TempDir(), "missing.json")}, err: "no such file or directory"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := NewCheckCommand()
+			assert.NoError(t, cmd.ParseFlags(tc.args))
+
+			request, err := simulatedRequest(cmd)
+			if len(tc.err) != 0 {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotEmpty(t, request.ID)
+			assert.Equal(t, tc.method, request.Request.Method)
+			assert.Equal(t, &tc.url, request.Request.URL)
+			assert.Equal(t, tc.url.Host, request.Request.Host)
+			assert.Equal(t, tc.header, request.Request.Header)
+			assert.Equal(t, tc.context, request.Context)
+			assert.Equal(t, tc.principal, request.Principal)
+		})
+	}
+}
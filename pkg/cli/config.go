@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/team-xquare/contour-middleware/pkg/config"
+)
+
+func NewConfigCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "config",
+		Short: "Check the configuration of the authentication server",
+	}
+
+	// The subcommands read the same config file, environment and flags as
+	// `auth run`.
+	addRunFlags(cmd.PersistentFlags())
+
+	cmd.AddCommand(Defaults(newConfigValidateCommand()))
+	cmd.AddCommand(Defaults(newConfigDumpCommand()))
+
+	return &cmd
+}
+
+func newConfigValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate [OPTIONS]",
+		Short: "Load the configuration and the files it refers to without serving",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := loadConfig(cmd); err != nil {
+				return err
+			}
+
+			if _, err := DefaultServer(cmd); err != nil {
+				return ExitErrorf(EX_CONFIG, "invalid TLS configuration: %s", err)
+			}
+
+			parser, err := DefaultParser(cmd)
+			if err != nil {
+				return ExitErrorf(EX_CONFIG, "invalid JWT configuration: %s", err)
+			}
+
+			if _, err := DefaultCheckService(cmd, logrus.New(), parser); err != nil {
+				return ExitError{EX_CONFIG, err}
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+			return nil
+		},
+	}
+}
+
+func newConfigDumpCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "dump [OPTIONS]",
+		Short: "Print the effective configuration as YAML, with secrets redacted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(mustString(cmd.Flags().GetString("config")), cmd.Flags())
+			if err != nil {
+				return ExitError{EX_CONFIG, err}
+			}
+
+			encoder := yaml.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent(2)
+			if err := encoder.Encode(cfg.Redacted()); err != nil {
+				return err
+			}
+
+			return encoder.Close()
+		},
+	}
+}
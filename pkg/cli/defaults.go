@@ -1,11 +1,20 @@
 package cli
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/team-xquare/contour-middleware/pkg/admin"
 	"github.com/team-xquare/contour-middleware/pkg/auth"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+	"github.com/team-xquare/contour-middleware/pkg/metrics"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
 )
@@ -19,6 +28,51 @@ func mustString(s string, err error) string {
 	return s
 }
 
+func mustStringSlice(s []string, err error) []string {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(int(EX_CONFIG))
+	}
+
+	return s
+}
+
+func mustStringArray(s []string, err error) []string {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(int(EX_CONFIG))
+	}
+
+	return s
+}
+
+func mustBool(b bool, err error) bool {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(int(EX_CONFIG))
+	}
+
+	return b
+}
+
+func mustInt(i int, err error) int {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(int(EX_CONFIG))
+	}
+
+	return i
+}
+
+func mustDuration(d time.Duration, err error) time.Duration {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(int(EX_CONFIG))
+	}
+
+	return d
+}
+
 func Defaults(c *cobra.Command) *cobra.Command {
 	c.SilenceUsage = true
 	c.SilenceErrors = true
@@ -27,12 +81,68 @@ func Defaults(c *cobra.Command) *cobra.Command {
 	return c
 }
 
-func DefaultServer(cmd *cobra.Command) (*grpc.Server, error) {
+// DefaultAdminServer returns the server of the admin API. It has a client
+// allowlist of its own, so that the clients of the authentication endpoint
+// cannot revoke tokens, and is only served without TLS on a Unix socket.
+// Changes are written to the revocations and not-before files, so it is
+// refused without them.
+func DefaultAdminServer(cmd *cobra.Command, parser *jwt.Parser) (*grpc.Server, error) {
+	if len(mustString(cmd.Flags().GetString("revocations-path"))) == 0 || len(mustString(cmd.Flags().GetString("not-before-path"))) == 0 {
+		return nil, errors.New("--revocations-path and --not-before-path are required to serve the admin API")
+	}
+
 	opts := []grpc.ServerOption{
-		grpc.MaxConcurrentStreams(1 << 20),
+		grpc.ChainUnaryInterceptor(metrics.UnaryServerInterceptor()),
 	}
 
-	creds, err := auth.NewServerCredentials(
+	if mustBool(cmd.Flags().GetBool("insecure")) {
+		if !strings.HasPrefix(mustString(cmd.Flags().GetString("admin-address")), "unix://") {
+			return nil, errors.New("with --insecure, the admin API is only served on a unix:// address")
+		}
+	} else {
+		names := mustStringSlice(cmd.Flags().GetStringSlice("admin-allowed-client-names"))
+		if len(names) == 0 {
+			return nil, errors.New("--admin-allowed-client-names is required to serve the admin API")
+		}
+
+		certificates, err := DefaultCertificates(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, grpc.Creds(auth.NewServerCredentials(certificates, auth.ClientVerification{
+			Mode:         tls.RequireAndVerifyClientCert,
+			AllowedNames: names,
+		})))
+	}
+
+	srv := grpc.NewServer(opts...)
+	admin.RegisterAdminServer(srv, admin.NewAdminServer(parser.Revocations, parser.NotBefore))
+
+	return srv, nil
+}
+
+// Listen listens on a TCP address, or on the Unix socket of a unix://
+// address. A socket left behind by a previous run is removed.
+func Listen(address string) (net.Listener, error) {
+	path := strings.TrimPrefix(address, "unix://")
+	if path == address {
+		return net.Listen("tcp", address)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// DefaultCertificates loads the server certificates and reloads them when
+// their files change.
+func DefaultCertificates(cmd *cobra.Command) (*auth.ServerCertificates, error) {
+	certificates, err := auth.LoadServerCertificates(
 		mustString(cmd.Flags().GetString("tls-cert-path")),
 		mustString(cmd.Flags().GetString("tls-key-path")),
 		mustString(cmd.Flags().GetString("tls-ca-path")),
@@ -41,6 +151,210 @@ func DefaultServer(cmd *cobra.Command) (*grpc.Server, error) {
 		return nil, err
 	}
 
-	opts = append(opts, grpc.Creds(creds))
+	go certificates.Watch(cmd.Context(), mustDuration(cmd.Flags().GetDuration("watch-interval")))
+	return certificates, nil
+}
+
+func DefaultServer(cmd *cobra.Command) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.MaxConcurrentStreams(1 << 20),
+		grpc.ChainUnaryInterceptor(metrics.UnaryServerInterceptor()),
+	}
+
+	if mustBool(cmd.Flags().GetBool("insecure")) {
+		return grpc.NewServer(opts...), nil
+	}
+
+	certificates, err := DefaultCertificates(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := auth.ParseClientAuth(mustString(cmd.Flags().GetString("tls-client-auth")))
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, grpc.Creds(auth.NewServerCredentials(certificates, auth.ClientVerification{
+		Mode:         mode,
+		AllowedNames: mustStringSlice(cmd.Flags().GetStringSlice("tls-allowed-client-names")),
+	})))
 	return grpc.NewServer(opts...), nil
 }
+
+// DefaultKeyring returns the keyring of --jwt-keyring-path, or the one
+// holding --jwt-secret or JWT_SECRET.
+func DefaultKeyring(cmd *cobra.Command) (*jwt.Keyring, error) {
+	if path := mustString(cmd.Flags().GetString("jwt-keyring-path")); len(path) != 0 {
+		keyring, err := jwt.LoadKeyring(path)
+		if err != nil {
+			return nil, err
+		}
+
+		go keyring.Watch(cmd.Context(), mustDuration(cmd.Flags().GetDuration("watch-interval")))
+		return keyring, nil
+	}
+
+	if secret := mustString(cmd.Flags().GetString("jwt-secret")); len(secret) != 0 {
+		return jwt.NewKeyring([]byte(secret)), nil
+	}
+
+	return jwt.DefaultKeyring(), nil
+}
+
+func DefaultParser(cmd *cobra.Command) (*jwt.Parser, error) {
+	keyring, err := DefaultKeyring(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := jwt.KeySources{keyring}
+
+	if source := mustString(cmd.Flags().GetString("jwks-source")); len(source) != 0 {
+		jwks, err := jwt.NewJWKS(source)
+		if err != nil {
+			return nil, err
+		}
+
+		go jwks.Run(cmd.Context(), mustDuration(cmd.Flags().GetDuration("jwks-refresh-interval")))
+		keys = append(keys, jwks)
+	}
+	if keyring.Empty() && len(keys) == 1 {
+		return nil, errors.New("no verification keys: set --jwt-secret, JWT_SECRET, --jwt-keyring-path or --jwks-source")
+	}
+
+	denylist := jwt.NewDenylist()
+	if path := mustString(cmd.Flags().GetString("revocations-path")); len(path) != 0 {
+		var err error
+		if denylist, err = jwt.LoadDenylist(path); err != nil {
+			return nil, err
+		}
+
+		go denylist.Watch(cmd.Context(), mustDuration(cmd.Flags().GetDuration("watch-interval")))
+	}
+	go denylist.Run(cmd.Context(), mustDuration(cmd.Flags().GetDuration("revocations-prune-interval")))
+
+	notBefore := jwt.NewNotBeforeStore()
+	if path := mustString(cmd.Flags().GetString("not-before-path")); len(path) != 0 {
+		var err error
+		if notBefore, err = jwt.LoadNotBeforeStore(path); err != nil {
+			return nil, err
+		}
+
+		go notBefore.Watch(cmd.Context(), mustDuration(cmd.Flags().GetDuration("watch-interval")))
+	}
+
+	algorithms := mustStringSlice(cmd.Flags().GetStringSlice("jwt-algorithms"))
+	if err := jwt.ValidateAlgorithms(algorithms); err != nil {
+		return nil, err
+	}
+
+	return &jwt.Parser{
+		Keys:       keys,
+		Algorithms: algorithms,
+		Expect: jwt.Expectations{
+			Issuer:   mustString(cmd.Flags().GetString("jwt-issuer")),
+			Audience: mustString(cmd.Flags().GetString("jwt-audience")),
+		},
+		Leeway:      mustDuration(cmd.Flags().GetDuration("jwt-leeway")),
+		Revocations: denylist,
+		NotBefore:   notBefore,
+	}, nil
+}
+
+func DefaultCheckService(cmd *cobra.Command, log *logrus.Logger, parser *jwt.Parser) (auth.CheckService, error) {
+	mode, err := auth.ParseAuthMode(mustString(cmd.Flags().GetString("auth-mode")))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []auth.Option{
+		auth.WithParser(parser),
+		auth.WithAuthMode(mode),
+		auth.WithAllowlistedPaths(mustStringSlice(cmd.Flags().GetStringSlice("allowlisted-paths"))),
+	}
+
+	if path := mustString(cmd.Flags().GetString("claim-headers-path")); len(path) != 0 {
+		headers, err := auth.LoadClaimHeaders(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, auth.WithClaimHeaders(headers))
+	}
+
+	if path := mustString(cmd.Flags().GetString("policies-path")); len(path) != 0 {
+		policies, err := auth.LoadPolicies(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, auth.WithPolicies(policies))
+	}
+
+	if path := mustString(cmd.Flags().GetString("htpasswd-path")); len(path) != 0 {
+		htpasswd, err := auth.LoadHTPasswd(path)
+		if err != nil {
+			return nil, err
+		}
+
+		go htpasswd.Watch(cmd.Context(), mustDuration(cmd.Flags().GetDuration("watch-interval")))
+		opts = append(opts, auth.WithHTPasswd(htpasswd))
+	}
+
+	if path := mustString(cmd.Flags().GetString("api-keys-path")); len(path) != 0 {
+		store, err := auth.LoadAPIKeyStore(path)
+		if err != nil {
+			return nil, err
+		}
+
+		go store.Watch(cmd.Context(), mustDuration(cmd.Flags().GetDuration("watch-interval")))
+		opts = append(opts, auth.WithAPIKeys(store,
+			mustString(cmd.Flags().GetString("api-key-header")),
+			mustString(cmd.Flags().GetString("api-key-query")),
+		))
+	}
+
+	opts = append(opts, auth.WithMTLSIdentity(
+		mustString(cmd.Flags().GetString("mtls-role")),
+		mustStringSlice(cmd.Flags().GetStringSlice("mtls-authorities")),
+	))
+
+	if size := mustInt(cmd.Flags().GetInt("token-cache-size")); size > 0 {
+		opts = append(opts, auth.WithTokenCache(auth.NewTokenCache(size, mustDuration(cmd.Flags().GetDuration("token-cache-ttl")))))
+	}
+
+	authenticators, err := DefaultAuthenticators(cmd)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, authenticators)
+
+	return auth.NewCheckService(log, opts...), nil
+}
+
+// DefaultAuthenticators builds the authenticator chain option. Listing an
+// authenticator whose credential store is not configured is an error.
+func DefaultAuthenticators(cmd *cobra.Command) (auth.Option, error) {
+	mode, err := auth.ParseChainMode(mustString(cmd.Flags().GetString("authenticator-chain")))
+	if err != nil {
+		return nil, err
+	}
+
+	var types []auth.AuthenticatorType
+	for _, name := range mustStringSlice(cmd.Flags().GetStringSlice("authenticators")) {
+		t, err := auth.ParseAuthenticatorType(name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case t == auth.AuthenticatorBasic && len(mustString(cmd.Flags().GetString("htpasswd-path"))) == 0:
+			return nil, fmt.Errorf("authenticator %q requires --htpasswd-path", t)
+		case t == auth.AuthenticatorAPIKey && len(mustString(cmd.Flags().GetString("api-keys-path"))) == 0:
+			return nil, fmt.Errorf("authenticator %q requires --api-keys-path", t)
+		}
+
+		types = append(types, t)
+	}
+
+	return auth.WithAuthenticators(mode, types...), nil
+}
@@ -13,7 +13,10 @@
 
 package cli
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // ExitCode is a process exit code suitable for use with os.Exit.
 type ExitCode int
@@ -59,3 +62,18 @@ func ExitErrorf(code ExitCode, format string, args ...interface{}) error {
 		Err:  fmt.Errorf(format, args...),
 	}
 }
+
+// ExitCodeOf returns the ExitCode carried by err, or EX_FAIL.
+func ExitCodeOf(err error) ExitCode {
+	var exitErr ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
+	var exitErrPtr *ExitError
+	if errors.As(err, &exitErrPtr) {
+		return exitErrPtr.Code
+	}
+
+	return EX_FAIL
+}
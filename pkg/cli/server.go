@@ -1,11 +1,21 @@
 package cli
 
 import (
-	"net"
+	"context"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/getsentry/sentry-go"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/team-xquare/contour-middleware/pkg/auth"
+	"github.com/team-xquare/contour-middleware/pkg/config"
+	"github.com/team-xquare/contour-middleware/pkg/health"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+	"github.com/team-xquare/contour-middleware/pkg/metrics"
 )
 
 func NewAuthServerCommand() *cobra.Command {
@@ -14,7 +24,53 @@ func NewAuthServerCommand() *cobra.Command {
 		Short: "Run a authentication server",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			listener, err := net.Listen("tcp", mustString(cmd.Flags().GetString("address")))
+			cfg, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			if dsn := cfg.Observability.SentryDSN; len(dsn) != 0 {
+				if err := sentry.Init(sentry.ClientOptions{Dsn: dsn, TracesSampleRate: 1.0}); err != nil {
+					return ExitErrorf(EX_CONFIG, "invalid Sentry DSN: %s", err)
+				}
+			}
+
+			drainTimeout := mustDuration(cmd.Flags().GetDuration("drain-timeout"))
+			shutdownDelay := mustDuration(cmd.Flags().GetDuration("shutdown-delay"))
+			checker := health.NewChecker(auth.ServiceNames, "tls", "keys", "config")
+
+			if address := mustString(cmd.Flags().GetString("metrics-address")); len(address) != 0 {
+				metricsListener, err := Listen(address)
+				if err != nil {
+					return ExitError{EX_CONFIG, err}
+				}
+
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", metrics.Handler())
+				checker.RegisterHandlers(mux)
+
+				metricsSrv := &http.Server{Handler: mux}
+				go func() {
+					if err := metricsSrv.Serve(metricsListener); err != http.ErrServerClosed {
+						logrus.WithError(err).Error("metrics server stopped")
+					}
+				}()
+				defer func() {
+					ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+					defer cancel()
+					_ = metricsSrv.Shutdown(ctx)
+				}()
+				logrus.WithField("address", address).Info("started serving metrics and health checks")
+			}
+
+			if mustBool(cmd.Flags().GetBool("insecure")) {
+				logrus.Warn("***************************************************************")
+				logrus.Warn("TLS IS DISABLED: --insecure serves plaintext gRPC without any")
+				logrus.Warn("client verification. Never use it outside local development.")
+				logrus.Warn("***************************************************************")
+			}
+
+			listener, err := Listen(mustString(cmd.Flags().GetString("address")))
 			if err != nil {
 				return ExitError{EX_CONFIG, err}
 			}
@@ -23,18 +79,131 @@ func NewAuthServerCommand() *cobra.Command {
 			if err != nil {
 				return ExitErrorf(EX_CONFIG, "invalid TLS configuration: %s", err)
 			}
+			checker.Set("tls", nil)
+
+			parser, err := DefaultParser(cmd)
+			if err != nil {
+				return ExitErrorf(EX_CONFIG, "invalid JWT configuration: %s", err)
+			}
+			checker.Set("keys", nil)
+
+			check, err := DefaultCheckService(cmd, logrus.New(), parser)
+			if err != nil {
+				return ExitError{EX_CONFIG, err}
+			}
+			checker.Set("config", nil)
+
+			auth.RegisterServer(srv, check)
+			checker.Register(srv)
+
+			if address := mustString(cmd.Flags().GetString("admin-address")); len(address) != 0 {
+				adminListener, err := Listen(address)
+				if err != nil {
+					return ExitError{EX_CONFIG, err}
+				}
+
+				adminSrv, err := DefaultAdminServer(cmd, parser)
+				if err != nil {
+					return ExitErrorf(EX_CONFIG, "invalid admin API configuration: %s", err)
+				}
+
+				go func() {
+					if err := adminSrv.Serve(adminListener); err != nil {
+						logrus.WithError(err).Error("admin server stopped")
+					}
+				}()
+				defer auth.StopServer(adminSrv, drainTimeout)
+				logrus.WithField("address", address).Info("started serving admin API")
+			}
+
+			// On SIGTERM or SIGINT, readiness fails for the shutdown delay
+			// first, so that Envoy stops routing calls here before the
+			// server stops accepting them and in-flight ones drain. A
+			// second signal skips the rest of the delay.
+			signals, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, syscall.SIGINT)
+			defer stop()
+
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
 
-			auth.RegisterServer(srv, auth.NewCheckService(logrus.New()))
+			go func() {
+				select {
+				case <-signals.Done():
+					stop()
+					interrupt, stopInterrupt := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+					defer stopInterrupt()
+
+					logrus.Infof("shutting down, failing readiness for %s, then draining for up to %s", shutdownDelay, drainTimeout)
+					checker.Drain(shutdownDelay, interrupt.Done(), cancel)
+				case <-ctx.Done():
+				}
+			}()
 
 			logrus.Info("started serving", "address", mustString(cmd.Flags().GetString("address")))
-			return auth.RunServer(listener, srv)
+			return auth.RunServer(ctx, listener, srv, drainTimeout)
 		},
 	}
 
-	cmd.Flags().String("address", ":9443", "The address the authentication endpoint binds to.")
-	cmd.Flags().String("tls-cert-path", "/tls/tls.crt", "Path to the TLS server certificate.")
-	cmd.Flags().String("tls-ca-path", "/tls/ca.crt", "Path to the TLS CA certificate bundle.")
-	cmd.Flags().String("tls-key-path", "/tls/tls.key", "Path to the TLS server key.")
+	addRunFlags(cmd.Flags())
 
 	return &cmd
 }
+
+// addRunFlags adds the settings of `auth run`, which config.Config mirrors,
+// to flags.
+func addRunFlags(flags *pflag.FlagSet) {
+	flags.String("config", "", "Path to a YAML or TOML config file; flags and AUTH_ environment variables override its settings.")
+	flags.String("address", ":9443", "The address the authentication endpoint binds to; unix:///path binds to a Unix socket.")
+	flags.String("metrics-address", ":9090", "The address Prometheus metrics (/metrics) and HTTP health checks (/healthz, /readyz) are served on; disabled when empty.")
+	flags.String("admin-address", "", "The address the admin API binds to; disabled when empty. Requires --revocations-path and --not-before-path on a volume shared by the replicas, which changes are written to.")
+	flags.StringSlice("admin-allowed-client-names", nil, "DNS or URI SANs and common names of which admin API client certificates must carry one; required unless the admin API is served on a unix:// address with --insecure.")
+	flags.Bool("insecure", false, "Serve plaintext gRPC without TLS, for local development only.")
+	flags.Duration("shutdown-delay", 5*time.Second, "How long readiness fails on shutdown before the server stops accepting new calls, so that Envoy stops routing them here first.")
+	flags.Duration("drain-timeout", 15*time.Second, "How long in-flight calls may take to complete on shutdown before connections are closed.")
+	flags.String("tls-cert-path", "/tls/tls.crt", "Path to the TLS server certificate.")
+	flags.String("tls-ca-path", "/tls/ca.crt", "Path to the CA certificate bundle client certificates are verified with.")
+	flags.String("tls-key-path", "/tls/tls.key", "Path to the TLS server key.")
+	flags.String("tls-client-auth", "verify-if-given", "Client certificate mode: none, verify-if-given or require. Envoy only presents a client certificate when Contour is configured with one, so only require it then.")
+	flags.StringSlice("tls-allowed-client-names", nil, "DNS or URI SANs and common names of which client certificates must carry one; any certificate signed by the CA is accepted when empty.")
+	flags.String("jwt-secret", "", "HMAC secret used when no keyring is configured; JWT_SECRET is used when unset.")
+	flags.String("jwt-keyring-path", "", "Path to a YAML keyring of HMAC secrets; JWT_SECRET is used when unset.")
+	flags.String("jwks-source", "", "Path or http(s) URL of a JWKS document used to verify asymmetric tokens.")
+	flags.Duration("jwks-refresh-interval", 5*time.Minute, "How often the JWKS document is refreshed.")
+	flags.StringSlice("jwt-algorithms", jwt.DefaultAlgorithms, "Signing algorithms accepted for JWT tokens.")
+	flags.String("jwt-issuer", "", "Issuer (iss) required in JWT tokens; a route may override it with the jwt-issuer context extension.")
+	flags.String("jwt-audience", "", "Audience (aud) required in JWT tokens; a route may override it with the jwt-audience context extension.")
+	flags.Duration("jwt-leeway", 0, "Clock skew tolerated when validating exp, nbf and iat.")
+	flags.String("revocations-path", "", "Path to a YAML list of revoked token ids and subjects.")
+	flags.Duration("revocations-prune-interval", time.Minute, "How often expired revocations are dropped.")
+	flags.String("not-before-path", "", "Path to a YAML mapping of subjects to the time before which their tokens are invalid.")
+	flags.Int("token-cache-size", 10000, "How many verified tokens are cached; caching is disabled when 0.")
+	flags.Duration("token-cache-ttl", time.Minute, "How long a verified token is cached at most, bounding how long tokens signed with a removed key are still accepted.")
+	flags.String("claim-headers-path", "", "Path to a YAML mapping of token claims to forwarded request headers.")
+	flags.String("policies-path", "", "Path to a YAML list of route authorization policies.")
+	flags.String("auth-mode", string(auth.AuthModeOptional), "Auth mode of routes that do not set one: optional, required or required-except-allowlisted-paths.")
+	flags.StringSlice("allowlisted-paths", nil, "Paths reachable without credentials in required-except-allowlisted-paths mode; a trailing * matches a prefix.")
+	flags.String("htpasswd-path", "", "Path to an htpasswd file (bcrypt or argon2) used to verify Basic credentials.")
+	flags.String("api-keys-path", "", "Path to a YAML store of hashed API keys for service-to-service callers.")
+	flags.String("api-key-header", auth.DefaultAPIKeyHeader, "Header carrying the API key.")
+	flags.String("api-key-query", "", "Query parameter carrying the API key when the header is absent; disabled when empty.")
+	flags.StringSlice("authenticators", nil, "Authenticators run in order: cookie, bearer, api-key, mtls and basic; defaults to cookie, bearer and the configured api-key and basic.")
+	flags.String("authenticator-chain", string(auth.ChainFirstMatch), "How authenticators combine: first-match or all-must-pass.")
+	flags.String("mtls-role", "SERVICE", "Role given to callers identified by their client certificate.")
+	flags.StringSlice("mtls-authorities", nil, "Authorities given to callers identified by their client certificate.")
+	flags.String("sentry-dsn", "", "Sentry DSN errors are reported to; SENTRY_DSN is used when unset.")
+	flags.Duration("watch-interval", 10*time.Second, "How often mounted files are checked for changes.")
+}
+
+// loadConfig merges the config file, the environment and the flags of cmd,
+// and validates the result.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	cfg, err := config.Load(mustString(cmd.Flags().GetString("config")), cmd.Flags())
+	if err != nil {
+		return nil, ExitError{EX_CONFIG, err}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, ExitError{EX_CONFIG, err}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,287 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+
+	"github.com/team-xquare/contour-middleware/pkg/auth"
+	"github.com/team-xquare/contour-middleware/pkg/config"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+func NewTokenCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "token",
+		Short: "Issue and debug JWT tokens with the keys of the authentication server",
+	}
+
+	// The subcommands read the keys and JWT settings from the same config
+	// file, environment and flags as `auth run`.
+	addRunFlags(cmd.PersistentFlags())
+
+	cmd.AddCommand(Defaults(newTokenMintCommand()))
+	cmd.AddCommand(Defaults(newTokenInspectCommand()))
+
+	return &cmd
+}
+
+func newTokenMintCommand() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "mint [OPTIONS]",
+		Short: "Sign a token with the primary key of the keyring, for local testing",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(mustString(cmd.Flags().GetString("config")), cmd.Flags())
+			if err != nil {
+				return ExitError{EX_CONFIG, err}
+			}
+
+			keyring, err := DefaultKeyring(cmd)
+			if err != nil {
+				return ExitErrorf(EX_CONFIG, "invalid JWT configuration: %s", err)
+			}
+			if keyring.Empty() {
+				return ExitErrorf(EX_CONFIG, "no signing key: set --jwt-secret, JWT_SECRET or --jwt-keyring-path")
+			}
+
+			claims, err := mintClaims(cmd, cfg, time.Now())
+			if err != nil {
+				return ExitError{EX_USAGE, err}
+			}
+
+			token, err := keyring.Sign(claims)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), token)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("sub", "", "Subject (sub) of the token.")
+	cmd.Flags().String("role", "", "Role of the subject, e.g. STUDENT or SERVICE.")
+	cmd.Flags().StringSlice("authorities", nil, "Authorities of the subject.")
+	cmd.Flags().Duration("exp", time.Hour, "How long the token is valid; it never expires when 0.")
+	cmd.Flags().String("iss", "", "Issuer (iss) of the token; defaults to --jwt-issuer.")
+	cmd.Flags().StringSlice("aud", nil, "Audiences (aud) of the token; defaults to --jwt-audience.")
+	cmd.Flags().String("jti", "", "Token id (jti); a random UUID when empty.")
+	cmd.Flags().StringArray("claim", nil, "Custom claim as NAME=VALUE; VALUE is parsed as JSON when it is valid JSON and is a string otherwise. May be repeated.")
+
+	return &cmd
+}
+
+func mintClaims(cmd *cobra.Command, cfg *config.Config, now time.Time) (*jwt.JWTClaims, error) {
+	claims := &jwt.JWTClaims{
+		Role:        mustString(cmd.Flags().GetString("role")),
+		Authorities: mustStringSlice(cmd.Flags().GetStringSlice("authorities")),
+		Audience:    mustStringSlice(cmd.Flags().GetStringSlice("aud")),
+		StandardClaims: jwtgo.StandardClaims{
+			Subject:  mustString(cmd.Flags().GetString("sub")),
+			Issuer:   mustString(cmd.Flags().GetString("iss")),
+			Id:       mustString(cmd.Flags().GetString("jti")),
+			IssuedAt: now.Unix(),
+		},
+	}
+
+	if len(claims.Issuer) == 0 {
+		claims.Issuer = cfg.JWT.Issuer
+	}
+	if len(claims.Audience) == 0 && len(cfg.JWT.Audience) != 0 {
+		claims.Audience = jwt.Audience{cfg.JWT.Audience}
+	}
+	if len(claims.Id) == 0 {
+		claims.Id = uuid.NewString()
+	}
+	if exp := mustDuration(cmd.Flags().GetDuration("exp")); exp != 0 {
+		claims.ExpiresAt = now.Add(exp).Unix()
+	}
+
+	for _, claim := range mustStringArray(cmd.Flags().GetStringArray("claim")) {
+		parts := strings.SplitN(claim, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("invalid claim %q: expected NAME=VALUE", claim)
+		}
+		name, value := parts[0], parts[1]
+		if _, ok := claims.Extra[name]; ok || jwt.IsRegisteredClaim(name) {
+			return nil, fmt.Errorf("invalid claim %q: %s is already set", claim, name)
+		}
+
+		if claims.Extra == nil {
+			claims.Extra = map[string]interface{}{}
+		}
+
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			parsed = value
+		}
+		claims.Extra[name] = parsed
+	}
+
+	return claims, nil
+}
+
+func newTokenInspectCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect [TOKEN]",
+		Short: "Decode a token and explain whether the server would accept it",
+		Long: `Decode a token and explain whether the server would accept it.
+
+The token is read from standard input when it is omitted or "-". The
+signature is verified against the configured keys and the claims are
+validated against the configured expectations, revocations and not-before
+times. The command fails when the token would be rejected.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := config.Load(mustString(cmd.Flags().GetString("config")), cmd.Flags()); err != nil {
+				return ExitError{EX_CONFIG, err}
+			}
+
+			token, err := readToken(cmd, args)
+			if err != nil {
+				return ExitError{EX_NOINPUT, err}
+			}
+
+			parser, err := DefaultParser(cmd)
+			if err != nil {
+				return ExitErrorf(EX_CONFIG, "invalid JWT configuration: %s", err)
+			}
+
+			mapping := auth.DefaultClaimHeaders
+			if path := mustString(cmd.Flags().GetString("claim-headers-path")); len(path) != 0 {
+				if mapping, err = auth.LoadClaimHeaders(path); err != nil {
+					return ExitError{EX_CONFIG, err}
+				}
+			}
+
+			return inspectToken(cmd.OutOrStdout(), parser, mapping, token, time.Now())
+		},
+	}
+}
+
+func readToken(cmd *cobra.Command, args []string) (string, error) {
+	if len(args) == 1 && args[0] != "-" {
+		return args[0], nil
+	}
+
+	data, err := ioutil.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimPrefix(strings.TrimSpace(string(data)), "Bearer ")
+	if len(token) == 0 {
+		return "", fmt.Errorf("no token given")
+	}
+
+	return token, nil
+}
+
+// inspectToken prints the header and claims of token, then the outcome of
+// each check the server runs on it.
+func inspectToken(w io.Writer, parser *jwt.Parser, mapping []auth.ClaimHeader, token string, now time.Time) error {
+	claims := &jwt.JWTClaims{}
+	decoded, _, err := new(jwtgo.Parser).ParseUnverified(token, claims)
+	if err != nil {
+		return ExitErrorf(EX_DATAERR, "malformed token: %s", err)
+	}
+
+	fmt.Fprintln(w, "Header:")
+	printJSON(w, decoded.Header)
+	fmt.Fprintln(w, "Claims:")
+	printJSON(w, claims)
+
+	fmt.Fprintln(w)
+	_, verifyErr := parser.Verify(token)
+	fmt.Fprintf(w, "Signature:   %s\n", outcome(verifyErr))
+	fmt.Fprintf(w, "Expiry:      %s\n", describeExpiry(claims.ExpiresAt, now))
+	fmt.Fprintf(w, "Revocation:  %s\n", describeRevocation(parser, claims))
+
+	err = verifyErr
+	if err == nil {
+		err = parser.Validate(claims, parser.Expect)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "Validation:  rejected: %s (%s)\n", err, jwt.Reason(err))
+	} else {
+		fmt.Fprintln(w, "Validation:  accepted")
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Forwarded headers:")
+	headers := auth.ClaimHeaders(mapping, claims)
+	headers.Set(auth.RequestIdHeader, "<generated for each request>")
+	printHeaders(w, headers)
+
+	if err != nil {
+		return ExitErrorf(EX_DATAERR, "token would be rejected: %s", jwt.Reason(err))
+	}
+
+	return nil
+}
+
+func printJSON(w io.Writer, v interface{}) {
+	data, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		fmt.Fprintf(w, "  <%s>\n", err)
+		return
+	}
+
+	fmt.Fprintf(w, "  %s\n", data)
+}
+
+func printHeaders(w io.Writer, headers http.Header) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range headers[name] {
+			fmt.Fprintf(w, "  %s: %s\n", name, value)
+		}
+	}
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return fmt.Sprintf("invalid: %s (%s)", err, jwt.Reason(err))
+	}
+
+	return "valid"
+}
+
+func describeExpiry(exp int64, now time.Time) string {
+	if exp == 0 {
+		return "never expires"
+	}
+
+	at := time.Unix(exp, 0)
+	if at.After(now) {
+		return fmt.Sprintf("expires at %s, in %s", at.Format(time.RFC3339), at.Sub(now).Round(time.Second))
+	}
+
+	return fmt.Sprintf("expired at %s, %s ago", at.Format(time.RFC3339), now.Sub(at).Round(time.Second))
+}
+
+func describeRevocation(parser *jwt.Parser, claims *jwt.JWTClaims) string {
+	switch {
+	case parser.Revocations != nil && parser.Revocations.Revoked(claims):
+		return "revoked by the denylist"
+	case parser.NotBefore != nil && parser.NotBefore.Rejects(claims):
+		return "issued before the sessions of the subject were invalidated"
+	}
+
+	return "not revoked"
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/team-xquare/contour-middleware/pkg/auth"
+	"github.com/team-xquare/contour-middleware/pkg/config"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+// subcommand returns the named subcommand of root with args parsed.
+func subcommand(t *testing.T, root *cobra.Command, name string, args ...string) *cobra.Command {
+	t.Helper()
+
+	cmd, _, err := root.Find([]string{name})
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.ParseFlags(args))
+
+	return cmd
+}
+
+func TestMintClaims(t *testing.T) {
+	now := time.Unix(1660000000, 0)
+
+	for _, tc := range []struct {
+		name     string
+		args     []string
+		expected *jwt.JWTClaims
+		err      string
+	}{
+		{
+			name: "defaults",
+			args: []string{"--jti", "1"},
+			expected: &jwt.JWTClaims{
+				Authorities:    []string{},
+				Audience:       jwt.Audience{},
+				StandardClaims: jwtgo.StandardClaims{Id: "1", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()},
+			},
+		},
+		{
+			name: "standard claims",
+			args: []string{
+				"--jti", "1", "--sub", "alice", "--role", "STU", "--authorities", "A,B",
+				"--exp", "15m", "--iss", "xquare", "--aud", "api,admin",
+			},
+			expected: &jwt.JWTClaims{
+				Role:        "STU",
+				Authorities: []string{"A", "B"},
+				Audience:    jwt.Audience{"api", "admin"},
+				StandardClaims: jwtgo.StandardClaims{
+					Id:        "1",
+					Subject:   "alice",
+					Issuer:    "xquare",
+					IssuedAt:  now.Unix(),
+					ExpiresAt: now.Add(15 * time.Minute).Unix(),
+				},
+			},
+		},
+		{
+			name: "configured expectations",
+			args: []string{"--jti", "1", "--exp", "0", "--jwt-issuer", "xquare", "--jwt-audience", "api"},
+			expected: &jwt.JWTClaims{
+				Authorities:    []string{},
+				Audience:       jwt.Audience{"api"},
+				StandardClaims: jwtgo.StandardClaims{Id: "1", Issuer: "xquare", IssuedAt: now.Unix()},
+			},
+		},
+		{
+			name: "custom claims",
+			args: []string{"--jti", "1", "--exp", "0", "--claim", `school={"id":3}`, "--claim", "nick=al", "--claim", "empty="},
+			expected: &jwt.JWTClaims{
+				Authorities:    []string{},
+				Audience:       jwt.Audience{},
+				StandardClaims: jwtgo.StandardClaims{Id: "1", IssuedAt: now.Unix()},
+				Extra: map[string]interface{}{
+					"school": map[string]interface{}{"id": float64(3)},
+					"nick":   "al",
+					"empty":  "",
+				},
+			},
+		},
+		{name: "registered claim", args: []string{"--claim", "sub=bob"}, err: `invalid claim "sub=bob": sub is already set`},
+		{name: "duplicate claim", args: []string{"--claim", "a=1", "--claim", "a=2"}, err: `invalid claim "a=2": a is already set`},
+		{name: "malformed claim", args: []string{"--claim", "nick"}, err: `invalid claim "nick": expected NAME=VALUE`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := subcommand(t, NewTokenCommand(), "mint", tc.args...)
+			cfg, err := config.Load("", cmd.Flags())
+			assert.NoError(t, err)
+
+			claims, err := mintClaims(cmd, cfg, now)
+			if len(tc.err) != 0 {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, claims)
+		})
+	}
+}
+
+func TestMintClaimsGeneratesID(t *testing.T) {
+	cmd := subcommand(t, NewTokenCommand(), "mint")
+	cfg, err := config.Load("", cmd.Flags())
+	assert.NoError(t, err)
+
+	first, err := mintClaims(cmd, cfg, time.Now())
+	assert.NoError(t, err)
+	second, err := mintClaims(cmd, cfg, time.Now())
+	assert.NoError(t, err)
+
+	assert.NotEmpty(t, first.Id)
+	assert.NotEqual(t, first.Id, second.Id)
+}
+
+func TestInspectToken(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	keyring := jwt.NewKeyring([]byte("secret"))
+
+	sign := func(keyring *jwt.Keyring, exp time.Time) string {
+		claims := &jwt.JWTClaims{Role: "STU", Authorities: []string{"A", "B"}}
+		claims.Subject = "alice"
+		claims.Id = "1"
+		claims.ExpiresAt = exp.Unix()
+
+		token, err := keyring.Sign(claims)
+		assert.NoError(t, err)
+		return token
+	}
+
+	for _, tc := range []struct {
+		name     string
+		token    string
+		expected []string
+		err      string
+	}{
+		{
+			name:  "valid",
+			token: sign(keyring, now.Add(time.Hour)),
+			expected: []string{
+				`"alg": "HS256"`,
+				`"sub": "alice"`,
+				"Signature:   valid\n",
+				"Expiry:      expires at " + now.Add(time.Hour).Format(time.RFC3339) + ", in 1h0m0s\n",
+				"Revocation:  not revoked\n",
+				"Validation:  accepted\n",
+				"  Request-Id: <generated for each request>\n",
+				"  Request-User-Authorities: A B\n",
+				"  Request-User-Id: alice\n",
+				"  Request-User-Role: STU\n",
+			},
+		},
+		{
+			name:  "expired",
+			token: sign(keyring, now.Add(-time.Minute)),
+			expected: []string{
+				"Signature:   valid\n",
+				"Expiry:      expired at ",
+				", 1m0s ago\n",
+				"Validation:  rejected: token is expired (expired)\n",
+				"  Request-User-Id: alice\n",
+			},
+			err: "token would be rejected: expired",
+		},
+		{
+			name:  "bad signature",
+			token: sign(jwt.NewKeyring([]byte("other")), now.Add(time.Hour)),
+			expected: []string{
+				"Signature:   invalid: signature is invalid (signature_invalid)\n",
+				"Validation:  rejected: signature is invalid (signature_invalid)\n",
+			},
+			err: "token would be rejected: signature_invalid",
+		},
+		{name: "malformed", token: "not-a-token", err: "malformed token: token contains an invalid number of segments"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := inspectToken(&out, &jwt.Parser{Keys: keyring}, auth.DefaultClaimHeaders, tc.token, now)
+
+			for _, expected := range tc.expected {
+				assert.Contains(t, out.String(), expected)
+			}
+
+			if len(tc.err) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.err)
+			assert.Equal(t, EX_DATAERR, ExitCodeOf(err))
+		})
+	}
+}
+
+func TestInspectRevokedToken(t *testing.T) {
+	keyring := jwt.NewKeyring([]byte("secret"))
+	denylist := jwt.NewDenylist()
+	assert.NoError(t, denylist.Revoke(jwt.Revocation{ID: "1"}))
+
+	claims := &jwt.JWTClaims{}
+	claims.Id = "1"
+	token, err := keyring.Sign(claims)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	err = inspectToken(&out, &jwt.Parser{Keys: keyring, Revocations: denylist}, auth.DefaultClaimHeaders, token, time.Now())
+	assert.EqualError(t, err, "token would be rejected: revoked")
+	assert.Equal(t, EX_DATAERR, ExitCodeOf(err))
+	assert.Contains(t, out.String(), "Expiry:      never expires\n")
+	assert.Contains(t, out.String(), "Revocation:  revoked by the denylist\n")
+}
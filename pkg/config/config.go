@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variables overriding the config file,
+// e.g. AUTH_TLS_CERTPATH for tls.certPath.
+const EnvPrefix = "AUTH"
+
+// Redacted replaces the value of secret settings in Config.Redacted.
+const Redacted = "REDACTED"
+
+// Config holds the settings of `auth run`. Every setting is also a flag,
+// named by the flag tag; the secret tag marks settings that must not be
+// printed.
+type Config struct {
+	Listeners      Listeners      `yaml:"listeners"`
+	TLS            TLS            `yaml:"tls"`
+	JWT            JWT            `yaml:"jwt"`
+	Revocation     Revocation     `yaml:"revocation"`
+	Authenticators Authenticators `yaml:"authenticators"`
+	Policies       Policies       `yaml:"policies"`
+	Observability  Observability  `yaml:"observability"`
+
+	WatchInterval time.Duration `yaml:"watchInterval" flag:"watch-interval"`
+}
+
+type Listeners struct {
+	Address        string        `yaml:"address" flag:"address"`
+	MetricsAddress string        `yaml:"metricsAddress" flag:"metrics-address"`
+	AdminAddress   string        `yaml:"adminAddress" flag:"admin-address"`
+	Insecure       bool          `yaml:"insecure" flag:"insecure"`
+	ShutdownDelay  time.Duration `yaml:"shutdownDelay" flag:"shutdown-delay"`
+	DrainTimeout   time.Duration `yaml:"drainTimeout" flag:"drain-timeout"`
+
+	AdminAllowedClientNames []string `yaml:"adminAllowedClientNames" flag:"admin-allowed-client-names"`
+}
+
+type TLS struct {
+	CertPath           string   `yaml:"certPath" flag:"tls-cert-path"`
+	KeyPath            string   `yaml:"keyPath" flag:"tls-key-path"`
+	CAPath             string   `yaml:"caPath" flag:"tls-ca-path"`
+	ClientAuth         string   `yaml:"clientAuth" flag:"tls-client-auth"`
+	AllowedClientNames []string `yaml:"allowedClientNames" flag:"tls-allowed-client-names"`
+}
+
+type JWT struct {
+	Secret              string        `yaml:"secret" flag:"jwt-secret" secret:"true"`
+	KeyringPath         string        `yaml:"keyringPath" flag:"jwt-keyring-path"`
+	JWKSSource          string        `yaml:"jwksSource" flag:"jwks-source"`
+	JWKSRefreshInterval time.Duration `yaml:"jwksRefreshInterval" flag:"jwks-refresh-interval"`
+	Algorithms          []string      `yaml:"algorithms" flag:"jwt-algorithms"`
+	Issuer              string        `yaml:"issuer" flag:"jwt-issuer"`
+	Audience            string        `yaml:"audience" flag:"jwt-audience"`
+	Leeway              time.Duration `yaml:"leeway" flag:"jwt-leeway"`
+	TokenCacheSize      int           `yaml:"tokenCacheSize" flag:"token-cache-size"`
+	TokenCacheTTL       time.Duration `yaml:"tokenCacheTTL" flag:"token-cache-ttl"`
+}
+
+type Revocation struct {
+	RevocationsPath string        `yaml:"revocationsPath" flag:"revocations-path"`
+	PruneInterval   time.Duration `yaml:"pruneInterval" flag:"revocations-prune-interval"`
+	NotBeforePath   string        `yaml:"notBeforePath" flag:"not-before-path"`
+}
+
+type Authenticators struct {
+	Types           []string `yaml:"types" flag:"authenticators"`
+	Chain           string   `yaml:"chain" flag:"authenticator-chain"`
+	HTPasswdPath    string   `yaml:"htpasswdPath" flag:"htpasswd-path"`
+	APIKeysPath     string   `yaml:"apiKeysPath" flag:"api-keys-path"`
+	APIKeyHeader    string   `yaml:"apiKeyHeader" flag:"api-key-header"`
+	APIKeyQuery     string   `yaml:"apiKeyQuery" flag:"api-key-query"`
+	MTLSRole        string   `yaml:"mtlsRole" flag:"mtls-role"`
+	MTLSAuthorities []string `yaml:"mtlsAuthorities" flag:"mtls-authorities"`
+}
+
+type Policies struct {
+	AuthMode         string   `yaml:"authMode" flag:"auth-mode"`
+	AllowlistedPaths []string `yaml:"allowlistedPaths" flag:"allowlisted-paths"`
+	PoliciesPath     string   `yaml:"policiesPath" flag:"policies-path"`
+	ClaimHeadersPath string   `yaml:"claimHeadersPath" flag:"claim-headers-path"`
+}
+
+type Observability struct {
+	SentryDSN string `yaml:"sentryDSN" flag:"sentry-dsn" secret:"true"`
+}
+
+// setting is a leaf of Config.
+type setting struct {
+	key    string
+	flag   string
+	secret bool
+	value  reflect.Value
+}
+
+func settings(v reflect.Value, prefix string) []setting {
+	var result []setting
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := prefix + field.Tag.Get("yaml")
+
+		if field.Type.Kind() == reflect.Struct {
+			result = append(result, settings(v.Field(i), key+".")...)
+			continue
+		}
+
+		result = append(result, setting{
+			key:    key,
+			flag:   field.Tag.Get("flag"),
+			secret: field.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+
+	return result
+}
+
+// Redacted returns a copy of c in which the secret settings that are set
+// are replaced by Redacted.
+func (c *Config) Redacted() *Config {
+	r := *c
+	for _, s := range settings(reflect.ValueOf(&r).Elem(), "") {
+		if s.secret && !s.value.IsZero() {
+			s.value.SetString(Redacted)
+		}
+	}
+
+	return &r
+}
+
+// Load reads the config file at path, which may be YAML or TOML, and the
+// AUTH_ environment variables into the flags that were not set on the
+// command line, and returns the resulting settings. An empty path only
+// reads the environment.
+func Load(path string, flags *pflag.FlagSet) (*Config, error) {
+	v := viper.New()
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	if len(path) != 0 {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+		}
+
+		// Reject unknown and mistyped settings.
+		if err := v.UnmarshalExact(&Config{}, func(c *mapstructure.DecoderConfig) {
+			c.TagName = "yaml"
+		}); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+
+	var c Config
+	for _, s := range settings(reflect.ValueOf(&c).Elem(), "") {
+		flag := flags.Lookup(s.flag)
+		if flag == nil {
+			return nil, fmt.Errorf("setting %s has no flag %q", s.key, s.flag)
+		}
+
+		if !flag.Changed && v.IsSet(s.key) {
+			if err := flags.Set(s.flag, flagValue(v.Get(s.key), flag)); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.key, err)
+			}
+		}
+
+		if err := readFlag(flags, s); err != nil {
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+func flagValue(value interface{}, flag *pflag.Flag) string {
+	if flag.Value.Type() == "stringSlice" {
+		if s, ok := value.(string); ok {
+			return s
+		}
+		return strings.Join(cast.ToStringSlice(value), ",")
+	}
+
+	return cast.ToString(value)
+}
+
+func readFlag(flags *pflag.FlagSet, s setting) error {
+	var err error
+	switch s.value.Interface().(type) {
+	case string:
+		var value string
+		value, err = flags.GetString(s.flag)
+		s.value.SetString(value)
+	case bool:
+		var value bool
+		value, err = flags.GetBool(s.flag)
+		s.value.SetBool(value)
+	case int:
+		var value int
+		value, err = flags.GetInt(s.flag)
+		s.value.SetInt(int64(value))
+	case time.Duration:
+		var value time.Duration
+		value, err = flags.GetDuration(s.flag)
+		s.value.SetInt(int64(value))
+	case []string:
+		var value []string
+		value, err = flags.GetStringSlice(s.flag)
+		s.value.Set(reflect.ValueOf(value))
+	default:
+		err = fmt.Errorf("unsupported type %s", s.value.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("setting %s: %w", s.key, err)
+	}
+
+	return nil
+}
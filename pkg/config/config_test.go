@@ -0,0 +1,201 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/team-xquare/contour-middleware/pkg/cli"
+	"github.com/team-xquare/contour-middleware/pkg/config"
+)
+
+func flags(t *testing.T, args ...string) *pflag.FlagSet {
+	f := cli.NewAuthServerCommand().Flags()
+	assert.NoError(t, f.Parse(args))
+	return f
+}
+
+func write(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, err := config.Load("", flags(t))
+	assert.NoError(t, err)
+	assert.Equal(t, ":9443", c.Listeners.Address)
+	assert.Equal(t, "verify-if-given", c.TLS.ClientAuth)
+	assert.Equal(t, 10000, c.JWT.TokenCacheSize)
+	assert.Equal(t, 10*time.Second, c.WatchInterval)
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := write(t, "auth.yaml", `
+listeners:
+  address: :8443
+  insecure: true
+jwt:
+  algorithms: [HS256, RS256]
+  tokenCacheTTL: 30s
+authenticators:
+  types:
+  - bearer
+  - mtls
+`)
+
+	c, err := config.Load(path, flags(t))
+	assert.NoError(t, err)
+	assert.Equal(t, ":8443", c.Listeners.Address)
+	assert.True(t, c.Listeners.Insecure)
+	assert.Equal(t, []string{"HS256", "RS256"}, c.JWT.Algorithms)
+	assert.Equal(t, 30*time.Second, c.JWT.TokenCacheTTL)
+	assert.Equal(t, []string{"bearer", "mtls"}, c.Authenticators.Types)
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := write(t, "auth.toml", `
+watchInterval = "1m"
+
+[policies]
+authMode = "required"
+allowlistedPaths = ["/healthz", "/public/*"]
+`)
+
+	c, err := config.Load(path, flags(t))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, c.WatchInterval)
+	assert.Equal(t, "required", c.Policies.AuthMode)
+	assert.Equal(t, []string{"/healthz", "/public/*"}, c.Policies.AllowlistedPaths)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := write(t, "auth.yaml", `
+listeners:
+  address: :1000
+  metricsAddress: :2000
+  adminAddress: :3000
+`)
+	t.Setenv("AUTH_LISTENERS_METRICSADDRESS", ":2001")
+	t.Setenv("AUTH_LISTENERS_ADMINADDRESS", ":3001")
+
+	c, err := config.Load(path, flags(t, "--admin-address", ":3002"))
+	assert.NoError(t, err)
+	assert.Equal(t, ":1000", c.Listeners.Address)
+	assert.Equal(t, ":2001", c.Listeners.MetricsAddress)
+	assert.Equal(t, ":3002", c.Listeners.AdminAddress)
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := write(t, "auth.yaml", `
+listeners:
+  adress: :8443
+`)
+
+	_, err := config.Load(path, flags(t))
+	assert.ErrorContains(t, err, "adress")
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	path := write(t, "auth.yaml", `
+jwt:
+  leeway: soon
+`)
+
+	_, err := config.Load(path, flags(t))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	c, err := config.Load("", flags(t,
+		"--tls-cert-path", "",
+		"--tls-key-path", filepath.Join(t.TempDir(), "missing.key"),
+		"--tls-client-auth", "sometimes",
+		"--jwt-algorithms", "none",
+		"--authenticators", "basic",
+		"--auth-mode", "never",
+	))
+	assert.NoError(t, err)
+
+	err = c.Validate()
+	assert.IsType(t, config.ValidationError{}, err)
+	errs := err.(config.ValidationError)
+	assert.Contains(t, errs, "tls.certPath: must be set")
+	assert.Contains(t, errs, `authenticators.types: "basic" requires authenticators.htpasswdPath`)
+	assert.Contains(t, err.Error(), "tls.keyPath")
+	assert.Contains(t, err.Error(), "tls.clientAuth")
+	assert.Contains(t, err.Error(), "jwt.algorithms")
+	assert.Contains(t, err.Error(), "policies.authMode")
+}
+
+func TestValidateInsecure(t *testing.T) {
+	c, err := config.Load("", flags(t, "--insecure"))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Validate())
+}
+
+func TestRedacted(t *testing.T) {
+	c, err := config.Load("", flags(t, "--jwt-secret", "hunter2", "--jwt-issuer", "xquare"))
+	assert.NoError(t, err)
+
+	r := c.Redacted()
+	assert.Equal(t, config.Redacted, r.JWT.Secret)
+	assert.Equal(t, "", r.Observability.SentryDSN)
+	assert.Equal(t, "xquare", r.JWT.Issuer)
+	assert.Equal(t, "hunter2", c.JWT.Secret)
+}
+
+func TestValidateAdmin(t *testing.T) {
+	files := []string{
+		"--revocations-path", write(t, "revocations.yaml", "[]"),
+		"--not-before-path", write(t, "not-before.yaml", "{}"),
+	}
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--insecure", "--admin-address", "unix:///tmp/admin.sock"}, ""},
+		{[]string{"--insecure", "--admin-address", ":9444"}, "listeners.adminAddress"},
+		{[]string{"--tls-client-auth", "none", "--admin-address", ":9444"}, "listeners.adminAllowedClientNames"},
+	} {
+		c, err := config.Load("", flags(t, append(tc.args, files...)...))
+		assert.NoError(t, err)
+
+		err = c.Validate()
+		if len(tc.err) == 0 {
+			assert.NoError(t, err, tc.args)
+		} else {
+			assert.ErrorContains(t, err, tc.err, tc.args)
+		}
+	}
+
+	c, err := config.Load("", flags(t, "--insecure", "--admin-address", "unix:///tmp/admin.sock"))
+	assert.NoError(t, err)
+	err = c.Validate()
+	assert.ErrorContains(t, err, "revocation.revocationsPath: must be set when listeners.adminAddress is set")
+	assert.ErrorContains(t, err, "revocation.notBeforePath: must be set when listeners.adminAddress is set")
+}
+
+func TestValidateRejectsIgnoredSettings(t *testing.T) {
+	path := write(t, "auth.yaml", `
+listeners:
+  insecure: true
+jwt:
+  algorithms: []
+`)
+
+	c, err := config.Load(path, flags(t))
+	assert.NoError(t, err)
+	assert.ErrorContains(t, c.Validate(), "jwt.algorithms: no signing algorithms")
+
+	c, err = config.Load("", flags(t,
+		"--tls-cert-path", "", "--tls-key-path", "", "--tls-ca-path", "",
+		"--tls-client-auth", "none", "--tls-allowed-client-names", "envoy",
+	))
+	assert.NoError(t, err)
+	assert.ErrorContains(t, c.Validate(), "tls.allowedClientNames: must be empty when tls.clientAuth is none")
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/team-xquare/contour-middleware/pkg/auth"
+	"github.com/team-xquare/contour-middleware/pkg/jwt"
+)
+
+// ValidationError lists every problem found in a Config.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate checks that the settings are consistent and that the files they
+// refer to exist. The content of the files is not checked.
+func (c *Config) Validate() error {
+	var errs ValidationError
+	check := func(key string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", key, err))
+		}
+	}
+
+	check("listeners.address", required(c.Listeners.Address))
+	check("listeners.shutdownDelay", notNegative(c.Listeners.ShutdownDelay.Seconds()))
+	check("listeners.drainTimeout", positive(c.Listeners.DrainTimeout.Seconds()))
+	check("watchInterval", positive(c.WatchInterval.Seconds()))
+
+	if len(c.Listeners.AdminAddress) != 0 {
+		switch {
+		case c.Listeners.Insecure && !strings.HasPrefix(c.Listeners.AdminAddress, "unix://"):
+			check("listeners.adminAddress", errors.New("must be a unix:// address when listeners.insecure is set"))
+		case !c.Listeners.Insecure && len(c.Listeners.AdminAllowedClientNames) == 0:
+			check("listeners.adminAllowedClientNames", errors.New("must be set when listeners.adminAddress is set"))
+		}
+		if len(c.Revocation.RevocationsPath) == 0 {
+			check("revocation.revocationsPath", errors.New("must be set when listeners.adminAddress is set"))
+		}
+		if len(c.Revocation.NotBeforePath) == 0 {
+			check("revocation.notBeforePath", errors.New("must be set when listeners.adminAddress is set"))
+		}
+	}
+
+	if !c.Listeners.Insecure {
+		check("tls.certPath", exists(c.TLS.CertPath, true))
+		check("tls.keyPath", exists(c.TLS.KeyPath, true))
+		check("tls.caPath", exists(c.TLS.CAPath, true))
+		mode, err := auth.ParseClientAuth(c.TLS.ClientAuth)
+		check("tls.clientAuth", err)
+		if err == nil && mode == tls.NoClientCert && len(c.TLS.AllowedClientNames) != 0 {
+			check("tls.allowedClientNames", errors.New("must be empty when tls.clientAuth is none"))
+		}
+	}
+
+	check("jwt.keyringPath", exists(c.JWT.KeyringPath, false))
+	check("jwt.algorithms", jwt.ValidateAlgorithms(c.JWT.Algorithms))
+	check("jwt.leeway", notNegative(c.JWT.Leeway.Seconds()))
+	check("jwt.tokenCacheSize", notNegative(float64(c.JWT.TokenCacheSize)))
+	if c.JWT.TokenCacheSize > 0 {
+		check("jwt.tokenCacheTTL", positive(c.JWT.TokenCacheTTL.Seconds()))
+	}
+	if len(c.JWT.JWKSSource) != 0 {
+		check("jwt.jwksRefreshInterval", positive(c.JWT.JWKSRefreshInterval.Seconds()))
+		if !strings.HasPrefix(c.JWT.JWKSSource, "http://") && !strings.HasPrefix(c.JWT.JWKSSource, "https://") {
+			check("jwt.jwksSource", exists(c.JWT.JWKSSource, true))
+		}
+	}
+
+	check("revocation.revocationsPath", exists(c.Revocation.RevocationsPath, false))
+	check("revocation.pruneInterval", positive(c.Revocation.PruneInterval.Seconds()))
+	check("revocation.notBeforePath", exists(c.Revocation.NotBeforePath, false))
+
+	for _, name := range c.Authenticators.Types {
+		t, err := auth.ParseAuthenticatorType(name)
+		check("authenticators.types", err)
+
+		switch {
+		case t == auth.AuthenticatorBasic && len(c.Authenticators.HTPasswdPath) == 0:
+			check("authenticators.types", errors.New(`"basic" requires authenticators.htpasswdPath`))
+		case t == auth.AuthenticatorAPIKey && len(c.Authenticators.APIKeysPath) == 0:
+			check("authenticators.types", errors.New(`"api-key" requires authenticators.apiKeysPath`))
+		}
+	}
+	_, err := auth.ParseChainMode(c.Authenticators.Chain)
+	check("authenticators.chain", err)
+	check("authenticators.htpasswdPath", exists(c.Authenticators.HTPasswdPath, false))
+	check("authenticators.apiKeysPath", exists(c.Authenticators.APIKeysPath, false))
+	check("authenticators.apiKeyHeader", required(c.Authenticators.APIKeyHeader))
+
+	_, err = auth.ParseAuthMode(c.Policies.AuthMode)
+	check("policies.authMode", err)
+	check("policies.policiesPath", exists(c.Policies.PoliciesPath, false))
+	check("policies.claimHeadersPath", exists(c.Policies.ClaimHeadersPath, false))
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func required(s string) error {
+	if len(s) == 0 {
+		return errors.New("must be set")
+	}
+
+	return nil
+}
+
+func positive(f float64) error {
+	if f <= 0 {
+		return errors.New("must be positive")
+	}
+
+	return nil
+}
+
+func notNegative(f float64) error {
+	if f < 0 {
+		return errors.New("must not be negative")
+	}
+
+	return nil
+}
+
+// exists checks that path names a readable file. An empty path is only
+// accepted when the file is optional.
+func exists(path string, required bool) error {
+	if len(path) == 0 {
+		if required {
+			return errors.New("must be set")
+		}
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package errors
+
+type ForbiddenError struct {
+	Policy string
+	Reason string
+}
+
+func NewForbiddenError(policy string, reason string) ForbiddenError {
+	return ForbiddenError{policy, reason}
+}
+
+func (e ForbiddenError) Error() string {
+	return "Forbidden by policy " + e.Policy + ": " + e.Reason
+}
@@ -0,0 +1,13 @@
+package errors
+
+type InvalidCredentialsError struct {
+	Scheme string
+}
+
+func NewInvalidCredentialsError(scheme string) InvalidCredentialsError {
+	return InvalidCredentialsError{scheme}
+}
+
+func (e InvalidCredentialsError) Error() string {
+	return "Invalid " + e.Scheme + " credentials"
+}
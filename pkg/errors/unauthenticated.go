@@ -0,0 +1,17 @@
+package errors
+
+type UnauthenticatedError struct {
+	Reason string
+}
+
+func NewUnauthenticatedError(reason string) UnauthenticatedError {
+	return UnauthenticatedError{reason}
+}
+
+func (e UnauthenticatedError) Error() string {
+	return "Authentication required: " + e.Reason
+}
+
+// ErrNoCredentials is returned by authenticators when a request carries
+// none of the credentials they understand.
+var ErrNoCredentials = NewUnauthenticatedError("no credentials")
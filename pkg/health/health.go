@@ -0,0 +1,147 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Checker tracks the readiness of the server as a set of named conditions,
+// such as the TLS material or the signing keys having been loaded. The
+// server is ready once every condition is met and until Shutdown is called.
+// Readiness is reported through the grpc.health.v1 service and over HTTP.
+type Checker struct {
+	services []string
+	grpc     *health.Server
+
+	mu         sync.RWMutex
+	conditions map[string]error
+	shutdown   bool
+}
+
+// NewChecker returns a checker waiting for the named conditions. services
+// are the gRPC services whose status follows the readiness of the server,
+// in addition to the overall "" service.
+func NewChecker(services []string, conditions ...string) *Checker {
+	c := &Checker{
+		services:   services,
+		grpc:       health.NewServer(),
+		conditions: map[string]error{},
+	}
+
+	for _, name := range conditions {
+		c.conditions[name] = errors.New("not loaded")
+	}
+	c.update()
+
+	return c
+}
+
+// Set records the outcome of loading the named condition; a nil err means
+// the condition is met.
+func (c *Checker) Set(name string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conditions[name] = err
+	c.update()
+}
+
+// Shutdown marks the server as no longer ready, so that clients stop
+// sending it requests.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.shutdown = true
+	c.update()
+}
+
+// Drain calls Shutdown, then waits for delay before calling stop, so that
+// health checkers and load balancers stop routing new requests here before
+// the server stops accepting them. A second signal on interrupt skips the
+// rest of the delay.
+func (c *Checker) Drain(delay time.Duration, interrupt <-chan struct{}, stop func()) {
+	c.Shutdown()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-interrupt:
+	}
+
+	stop()
+}
+
+// Ready returns nil when the server is ready, or an error listing the
+// conditions that are not met.
+func (c *Checker) Ready() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.ready()
+}
+
+func (c *Checker) ready() error {
+	if c.shutdown {
+		return errors.New("shutting down")
+	}
+
+	var failures []string
+	for name, err := range c.conditions {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	if len(failures) != 0 {
+		sort.Strings(failures)
+		return errors.New(strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// update publishes the readiness to the gRPC health service. It must be
+// called with c.mu held.
+func (c *Checker) update() {
+	status := healthpb.HealthCheckResponse_SERVING
+	if c.ready() != nil {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	c.grpc.SetServingStatus("", status)
+	for _, service := range c.services {
+		c.grpc.SetServingStatus(service, status)
+	}
+}
+
+// Register registers the grpc.health.v1 service on srv.
+func (c *Checker) Register(srv *grpc.Server) {
+	healthpb.RegisterHealthServer(srv, c.grpc)
+}
+
+// RegisterHandlers serves /healthz, which succeeds as long as the process
+// serves HTTP, and /readyz, which succeeds when the server is ready.
+func (c *Checker) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := c.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
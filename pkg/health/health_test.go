@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func servingStatus(t *testing.T, c *Checker, service string) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+
+	res, err := c.grpc.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	assert.NoError(t, err)
+	return res.GetStatus()
+}
+
+func readyz(c *Checker) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	c.RegisterHandlers(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	return w
+}
+
+func TestChecker(t *testing.T) {
+	c := NewChecker([]string{"envoy.service.auth.v3.Authorization"}, "tls", "keys")
+
+	assert.EqualError(t, c.Ready(), "keys: not loaded; tls: not loaded")
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, c, ""))
+	assert.Equal(t, http.StatusServiceUnavailable, readyz(c).Code)
+
+	c.Set("tls", nil)
+	c.Set("keys", errors.New("invalid keyring"))
+	assert.EqualError(t, c.Ready(), "keys: invalid keyring")
+
+	c.Set("keys", nil)
+	assert.NoError(t, c.Ready())
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, servingStatus(t, c, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, servingStatus(t, c, "envoy.service.auth.v3.Authorization"))
+	assert.Equal(t, http.StatusOK, readyz(c).Code)
+
+	c.Shutdown()
+	assert.EqualError(t, c.Ready(), "shutting down")
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, c, "envoy.service.auth.v3.Authorization"))
+	assert.Equal(t, http.StatusServiceUnavailable, readyz(c).Code)
+}
+
+func TestHealthz(t *testing.T) {
+	mux := http.NewServeMux()
+	NewChecker(nil, "tls").RegisterHandlers(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestDrain(t *testing.T) {
+	c := NewChecker(nil)
+	assert.NoError(t, c.Ready())
+
+	delay := 50 * time.Millisecond
+	start := time.Now()
+
+	stopped := false
+	c.Drain(delay, nil, func() {
+		// Readiness fails for the whole delay before stopping.
+		assert.EqualError(t, c.Ready(), "shutting down")
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, c, ""))
+		assert.GreaterOrEqual(t, time.Since(start), delay)
+		stopped = true
+	})
+	assert.True(t, stopped)
+}
+
+func TestDrainInterrupted(t *testing.T) {
+	c := NewChecker(nil)
+
+	interrupt := make(chan struct{})
+	close(interrupt)
+
+	start := time.Now()
+	c.Drain(time.Hour, interrupt, func() {})
+	assert.Less(t, time.Since(start), time.Minute)
+	assert.EqualError(t, c.Ready(), "shutting down")
+}
@@ -0,0 +1,50 @@
+package jwt
+
+import (
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Validation errors in addition to the ones defined by jwt-go. They are
+// always reported together with the closest jwt-go flag, so callers that
+// only know about jwt-go keep working.
+const (
+	ValidationErrorAlgorithmNotAllowed uint32 = 1 << (16 + iota) // Signing method is not in the allowed list
+	ValidationErrorKeyNotFound                                   // No key matches the token's `kid` and method
+	ValidationErrorRevoked                                       // Token id or subject is on the denylist
+)
+
+var validationErrorReasons = []struct {
+	flag   uint32
+	reason string
+}{
+	{ValidationErrorAlgorithmNotAllowed, "algorithm_not_allowed"},
+	{ValidationErrorKeyNotFound, "key_not_found"},
+	{ValidationErrorRevoked, "revoked"},
+	{jwt.ValidationErrorMalformed, "malformed"},
+	{jwt.ValidationErrorUnverifiable, "unverifiable"},
+	{jwt.ValidationErrorSignatureInvalid, "signature_invalid"},
+	{jwt.ValidationErrorExpired, "expired"},
+	{jwt.ValidationErrorNotValidYet, "not_valid_yet"},
+	{jwt.ValidationErrorIssuedAt, "issued_at_invalid"},
+	{jwt.ValidationErrorIssuer, "issuer_invalid"},
+	{jwt.ValidationErrorAudience, "audience_invalid"},
+	{jwt.ValidationErrorId, "id_invalid"},
+	{jwt.ValidationErrorClaimsInvalid, "claims_invalid"},
+}
+
+// Reason returns a short, stable identifier for the cause of a validation
+// error, suitable for logs and metric labels.
+func Reason(err error) string {
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		return "unknown"
+	}
+
+	for _, r := range validationErrorReasons {
+		if ve.Errors&r.flag != 0 {
+			return r.reason
+		}
+	}
+
+	return "invalid"
+}
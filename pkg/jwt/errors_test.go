@@ -0,0 +1,17 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReason(t *testing.T) {
+	assert.Equal(t, "expired", Reason(jwt.NewValidationError("", jwt.ValidationErrorExpired)))
+	assert.Equal(t, "algorithm_not_allowed", Reason(jwt.NewValidationError("", jwt.ValidationErrorSignatureInvalid|ValidationErrorAlgorithmNotAllowed)))
+	assert.Equal(t, "key_not_found", Reason(jwt.NewValidationError("", jwt.ValidationErrorUnverifiable|ValidationErrorKeyNotFound)))
+	assert.Equal(t, "revoked", Reason(jwt.NewValidationError("", jwt.ValidationErrorClaimsInvalid|ValidationErrorRevoked)))
+	assert.Equal(t, "unknown", Reason(errors.New("boom")))
+}
@@ -0,0 +1,271 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+)
+
+// jwksMinRefreshInterval bounds how often an unknown `kid` may trigger an
+// out-of-band refresh of the key set.
+const jwksMinRefreshInterval = 30 * time.Second
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type verificationKey struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+// JWKS is a KeySource backed by a JSON Web Key Set read from a file or an
+// HTTP endpoint. The parsed keys are cached and refreshed periodically by
+// Run, or on demand when a token references an unknown `kid`.
+type JWKS struct {
+	source string
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        []verificationKey
+	lastRefresh time.Time
+}
+
+// NewJWKS loads the key set from source, which is either a file path or an
+// http(s):// URL.
+func NewJWKS(source string) (*JWKS, error) {
+	s := &JWKS{
+		source: source,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *JWKS) Keys(token *jwt.Token) ([]interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	keys := s.lookup(kid, token.Method)
+	if len(keys) == 0 && len(kid) != 0 && s.claimRefresh() {
+		if err := s.reload(); err != nil {
+			logrus.WithError(err).Warnf("failed to refresh JWKS from %s", s.source)
+		}
+		keys = s.lookup(kid, token.Method)
+	}
+
+	return keys, nil
+}
+
+// Refresh reloads the key set from its source. The previous keys are kept
+// when loading fails.
+func (s *JWKS) Refresh() error {
+	s.mu.Lock()
+	s.lastRefresh = time.Now()
+	s.mu.Unlock()
+
+	return s.reload()
+}
+
+func (s *JWKS) reload() error {
+	data, err := s.fetch()
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Run refreshes the key set every interval until ctx is done.
+func (s *JWKS) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil {
+				logrus.WithError(err).Warnf("failed to refresh JWKS from %s", s.source)
+			}
+		}
+	}
+}
+
+// claimRefresh reports whether an on-demand refresh may run now, and if so
+// marks it as started, so concurrent lookups of unknown `kid`s trigger a
+// single fetch.
+func (s *JWKS) claimRefresh() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastRefresh) < jwksMinRefreshInterval {
+		return false
+	}
+	s.lastRefresh = time.Now()
+
+	return true
+}
+
+func (s *JWKS) lookup(kid string, method jwt.SigningMethod) []interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []interface{}
+	for _, k := range s.keys {
+		if len(kid) != 0 && k.kid != kid {
+			continue
+		}
+		if len(k.alg) != 0 && k.alg != method.Alg() {
+			continue
+		}
+		if keyMatchesMethod(k.key, method) {
+			keys = append(keys, k.key)
+		}
+	}
+
+	return keys
+}
+
+func (s *JWKS) fetch() ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return ioutil.ReadFile(s.source)
+	}
+
+	resp, err := s.client.Get(s.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching JWKS: %s", resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func parseJWKS(data []byte) ([]verificationKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS document: %w", err)
+	}
+
+	var keys []verificationKey
+	for _, k := range set.Keys {
+		if len(k.Use) != 0 && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			logrus.WithError(err).Warnf("skipping JWK %q", k.Kid)
+			continue
+		}
+		keys = append(keys, verificationKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("unsupported RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %q", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := jwt.DecodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := jwt.DecodeSegment(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,168 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"n":   jwt.EncodeSegment(key.N.Bytes()),
+		"e":   jwt.EncodeSegment(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   jwt.EncodeSegment(key.X.Bytes()),
+		"y":   jwt.EncodeSegment(key.Y.Bytes()),
+	}
+}
+
+func ed25519JWK(kid string, key ed25519.PublicKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"x":   jwt.EncodeSegment(key),
+	}
+}
+
+func jwksDocument(t *testing.T, keys ...map[string]string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	assert.NoError(t, err)
+
+	return data
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+
+	claims := &JWTClaims{Role: "STU", StandardClaims: jwt.StandardClaims{Subject: "kimxwan0319"}}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+
+	return signed
+}
+
+func TestJWKSFromFile(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	err := ioutil.WriteFile(path, jwksDocument(t,
+		rsaJWK("rsa", &rsaKey.PublicKey),
+		ecJWK("ec", &ecKey.PublicKey),
+		ed25519JWK("ed", edPublic),
+	), 0600)
+	assert.NoError(t, err)
+
+	jwks, err := NewJWKS(path)
+	assert.NoError(t, err)
+	parser := &Parser{Keys: jwks}
+
+	for _, token := range []string{
+		signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey),
+		signToken(t, jwt.SigningMethodES256, "ec", ecKey),
+		signToken(t, SigningMethodEd25519, "ed", edPrivate),
+	} {
+		claims, err := parser.Parse(token)
+		assert.NoError(t, err)
+		assert.Equal(t, "kimxwan0319", claims.Subject)
+	}
+
+	_, err = parser.Parse(signToken(t, jwt.SigningMethodRS256, "ec", rsaKey))
+	assert.IsType(t, &ValidationError{}, err)
+}
+
+func TestJWKSRefreshOnUnknownKid(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var mu sync.Mutex
+	document := jwksDocument(t, rsaJWK("old", &oldKey.PublicKey))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(document)
+	}))
+	defer srv.Close()
+
+	jwks, err := NewJWKS(srv.URL)
+	assert.NoError(t, err)
+	parser := &Parser{Keys: jwks}
+
+	_, err = parser.Parse(signToken(t, jwt.SigningMethodRS256, "old", oldKey))
+	assert.NoError(t, err)
+
+	mu.Lock()
+	document = jwksDocument(t, rsaJWK("old", &oldKey.PublicKey), rsaJWK("new", &newKey.PublicKey))
+	mu.Unlock()
+
+	jwks.lastRefresh = time.Now().Add(-jwksMinRefreshInterval)
+	_, err = parser.Parse(signToken(t, jwt.SigningMethodRS256, "new", newKey))
+	assert.NoError(t, err)
+}
+
+func TestJWKSRefreshOnUnknownKidIsThrottled(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var mu sync.Mutex
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		w.Write(jwksDocument(t, rsaJWK("known", &key.PublicKey)))
+	}))
+	defer srv.Close()
+
+	jwks, err := NewJWKS(srv.URL)
+	assert.NoError(t, err)
+	jwks.lastRefresh = time.Now().Add(-jwksMinRefreshInterval)
+	parser := &Parser{Keys: jwks}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := parser.Parse(signToken(t, jwt.SigningMethodRS256, fmt.Sprintf("forged-%d", i), forged))
+			assert.Error(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, fetches)
+}
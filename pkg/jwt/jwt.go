@@ -1,35 +1,194 @@
 package jwt
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
 var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 
+var defaultKeyring = NewKeyring(jwtSecret)
+
+var defaultParser = &Parser{Keys: defaultKeyring}
+
 type ValidationError = jwt.ValidationError
 
 type JWTClaims struct {
 	Role        string   `json:"role"`
 	Authorities []string `json:"authorities"`
+	Audience    Audience `json:"aud,omitempty"`
 	jwt.StandardClaims
+
+	// Extra holds the claims that have no field of their own, e.g. a
+	// school id added by the identity service.
+	Extra map[string]interface{} `json:"-"`
 }
 
-func (c *JWTClaims) ToJWTToken() string {
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
-	token, _ := at.SignedString([]byte(jwtSecret))
+var registeredClaims = map[string]bool{
+	"role": true, "authorities": true, "aud": true, "exp": true,
+	"jti": true, "iat": true, "iss": true, "nbf": true, "sub": true,
+}
 
-	return token
+// IsRegisteredClaim reports whether name is a claim with a field of its own
+// in JWTClaims rather than an entry of Extra.
+func IsRegisteredClaim(name string) bool {
+	return registeredClaims[name]
 }
 
-func ParseJWTToken(jwtToken string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(jwtToken, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+func (c *JWTClaims) UnmarshalJSON(data []byte) error {
+	type claims JWTClaims
+	if err := json.Unmarshal(data, (*claims)(c)); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&all); err != nil {
+		return err
+	}
+
+	c.Extra = nil
+	for k, v := range all {
+		if registeredClaims[k] {
+			continue
+		}
+		if c.Extra == nil {
+			c.Extra = map[string]interface{}{}
+		}
+		c.Extra[k] = v
+	}
+
+	return nil
+}
+
+func (c JWTClaims) MarshalJSON() ([]byte, error) {
+	type claims JWTClaims
+	data, err := json.Marshal(claims(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+
+	all := map[string]interface{}{}
+	for k, v := range c.Extra {
+		all[k] = v
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&all); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(all)
+}
+
+// AsMap returns the claims as they appear in the token, with numbers as
+// json.Number.
+func (c *JWTClaims) AsMap() (map[string]interface{}, error) {
+	type claims JWTClaims
+	data, err := json.Marshal((*claims)(c))
 	if err != nil {
 		return nil, err
 	}
 
-	return token.Claims.(*JWTClaims), nil
+	all := make(map[string]interface{}, len(c.Extra)+len(registeredClaims))
+	for k, v := range c.Extra {
+		all[k] = v
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&all); err != nil {
+		return nil, err
+	}
+
+	return all, nil
+}
+
+// Claim returns the claim at a dotted path such as "school.id".
+func (c *JWTClaims) Claim(path string) (interface{}, bool) {
+	all, err := c.AsMap()
+	if err != nil {
+		return nil, false
+	}
+
+	return LookupClaim(all, path)
+}
+
+// LookupClaim returns the claim at a dotted path in claims returned by
+// AsMap, so that several claims are read with a single conversion.
+func LookupClaim(claims map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, value != nil
+}
+
+// Audience is the `aud` claim, which may be either a single string or an
+// array of strings. It shadows the string-only StandardClaims.Audience.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+
+	*a = multiple
+	return nil
+}
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+func (a Audience) Contains(audience string) bool {
+	for _, v := range a {
+		if v == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *JWTClaims) ToJWTToken() string {
+	token, _ := defaultKeyring.Sign(c)
+
+	return token
+}
+
+// DefaultKeyring returns the keyring holding JWT_SECRET.
+func DefaultKeyring() *Keyring {
+	return defaultKeyring
+}
+
+// DefaultParser returns the parser that verifies tokens against JWT_SECRET.
+func DefaultParser() *Parser {
+	return defaultParser
+}
+
+func ParseJWTToken(jwtToken string) (*JWTClaims, error) {
+	return defaultParser.Parse(jwtToken)
 }
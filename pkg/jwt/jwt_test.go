@@ -1,12 +1,23 @@
 package jwt
 
 import (
+	"fmt"
+	"os"
 	"testing"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestMain(m *testing.M) {
+	// JWT_SECRET is not set in tests, which leaves the default keyring
+	// empty.
+	key := HMACKey{Secret: "secret"}
+	defaultKeyring.primary, defaultKeyring.keys = key, []HMACKey{key}
+
+	os.Exit(m.Run())
+}
+
 func TestJWTToken(t *testing.T) {
 	jwtClaims := &JWTClaims{Role: "STU", Authorities: []string{"학생"}, StandardClaims: jwt.StandardClaims{Subject: "kimxwan0319"}}
 	token := jwtClaims.ToJWTToken()
@@ -15,3 +26,38 @@ func TestJWTToken(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, jwtClaims, result)
 }
+
+func TestJWTTokenWithExtraClaims(t *testing.T) {
+	jwtClaims := &JWTClaims{
+		Role:           "STU",
+		StandardClaims: jwt.StandardClaims{Subject: "kimxwan0319"},
+		Extra: map[string]interface{}{
+			"school": map[string]interface{}{"id": "dsm", "grade": 2},
+		},
+	}
+	token := jwtClaims.ToJWTToken()
+
+	result, err := ParseJWTToken(token)
+	assert.NoError(t, err)
+
+	id, ok := result.Claim("school.id")
+	assert.True(t, ok)
+	assert.Equal(t, "dsm", id)
+
+	grade, ok := result.Claim("school.grade")
+	assert.True(t, ok)
+	assert.Equal(t, "2", fmt.Sprint(grade))
+
+	sub, ok := result.Claim("sub")
+	assert.True(t, ok)
+	assert.Equal(t, "kimxwan0319", sub)
+
+	_, ok = result.Claim("school.class")
+	assert.False(t, ok)
+
+	all, err := result.AsMap()
+	assert.NoError(t, err)
+	assert.Equal(t, "STU", all["role"])
+	_, ok = LookupClaim(all, "role.name")
+	assert.False(t, ok)
+}
@@ -0,0 +1,175 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/yaml.v3"
+
+	"github.com/team-xquare/contour-middleware/pkg/watch"
+)
+
+type HMACKey struct {
+	Kid    string `yaml:"kid"`
+	Secret string `yaml:"secret"`
+}
+
+type keyringFile struct {
+	Primary string    `yaml:"primary"`
+	Keys    []HMACKey `yaml:"keys"`
+}
+
+// Keyring is a KeySource holding a primary HMAC key that signs new tokens
+// and any number of verification-only keys. Tokens carrying a `kid` are
+// verified with the matching key, others are tried against every key in
+// order, so a secret can be rotated without invalidating live sessions.
+// Keys without a kid are tried for every token.
+type Keyring struct {
+	path string
+
+	mu      sync.RWMutex
+	primary HMACKey
+	keys    []HMACKey
+}
+
+// NewKeyring returns a keyring with secret as its only key. An empty secret
+// gives an empty keyring, which neither verifies nor signs tokens.
+func NewKeyring(secret []byte) *Keyring {
+	if len(secret) == 0 {
+		return &Keyring{}
+	}
+
+	key := HMACKey{Secret: string(secret)}
+
+	return &Keyring{primary: key, keys: []HMACKey{key}}
+}
+
+// Empty reports whether the keyring holds no key.
+func (k *Keyring) Empty() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return len(k.keys) == 0
+}
+
+// LoadKeyring reads a keyring from a YAML file of the form
+//
+//	primary: 2022-07
+//	keys:
+//	  - kid: 2022-07
+//	    secret: ...
+//	  - kid: 2022-01
+//	    secret: ...
+//
+// When primary is omitted the first key signs new tokens.
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Reload re-reads the keyring file.
+func (k *Keyring) Reload() error {
+	data, err := ioutil.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+
+	var file keyringFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid keyring %s: %w", k.path, err)
+	}
+
+	primary, err := file.validate()
+	if err != nil {
+		return fmt.Errorf("invalid keyring %s: %w", k.path, err)
+	}
+
+	k.mu.Lock()
+	k.primary = primary
+	k.keys = file.Keys
+	k.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the keyring whenever its file changes, until ctx is done.
+func (k *Keyring) Watch(ctx context.Context, interval time.Duration) {
+	watch.Reload(ctx, interval, "keyring", k.Reload, k.path)
+}
+
+func (k *Keyring) Keys(token *jwt.Token) ([]interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var keys []interface{}
+	for _, key := range k.keys {
+		if len(kid) != 0 && len(key.Kid) != 0 && key.Kid != kid {
+			continue
+		}
+		keys = append(keys, []byte(key.Secret))
+	}
+
+	return keys, nil
+}
+
+// Sign signs claims with the primary key using HS256.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	primary := k.primary
+	k.mu.RUnlock()
+
+	if len(primary.Secret) == 0 {
+		return "", errors.New("keyring has no signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if len(primary.Kid) != 0 {
+		token.Header["kid"] = primary.Kid
+	}
+
+	return token.SignedString([]byte(primary.Secret))
+}
+
+func (f *keyringFile) validate() (HMACKey, error) {
+	if len(f.Keys) == 0 {
+		return HMACKey{}, errors.New("no keys")
+	}
+
+	seen := map[string]bool{}
+	for _, key := range f.Keys {
+		if len(key.Secret) == 0 {
+			return HMACKey{}, fmt.Errorf("key %q has an empty secret", key.Kid)
+		}
+		if len(key.Kid) != 0 && seen[key.Kid] {
+			return HMACKey{}, fmt.Errorf("duplicate kid %q", key.Kid)
+		}
+		seen[key.Kid] = true
+	}
+
+	if len(f.Primary) == 0 {
+		return f.Keys[0], nil
+	}
+
+	for _, key := range f.Keys {
+		if key.Kid == f.Primary {
+			return key, nil
+		}
+	}
+
+	return HMACKey{}, fmt.Errorf("primary key %q not found", f.Primary)
+}
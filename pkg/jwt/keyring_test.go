@@ -0,0 +1,115 @@
+package jwt
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKeyring(t *testing.T, path string, content string) {
+	t.Helper()
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+}
+
+func TestKeyringRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.yaml")
+	writeKeyring(t, path, `
+keys:
+  - kid: old
+    secret: old-secret
+`)
+
+	keyring, err := LoadKeyring(path)
+	assert.NoError(t, err)
+	parser := &Parser{Keys: keyring}
+
+	claims := &JWTClaims{Role: "STU", StandardClaims: jwt.StandardClaims{Subject: "kimxwan0319"}}
+	oldToken, err := keyring.Sign(claims)
+	assert.NoError(t, err)
+
+	writeKeyring(t, path, `
+primary: new
+keys:
+  - kid: new
+    secret: new-secret
+  - kid: old
+    secret: old-secret
+`)
+	assert.NoError(t, keyring.Reload())
+
+	newToken, err := keyring.Sign(claims)
+	assert.NoError(t, err)
+
+	token, _, err := new(jwt.Parser).ParseUnverified(newToken, &JWTClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", token.Header["kid"])
+
+	for _, tokenString := range []string{oldToken, newToken} {
+		result, err := parser.Parse(tokenString)
+		assert.NoError(t, err)
+		assert.Equal(t, claims, result)
+	}
+
+	writeKeyring(t, path, `
+keys:
+  - kid: new
+    secret: new-secret
+`)
+	assert.NoError(t, keyring.Reload())
+
+	_, err = parser.Parse(oldToken)
+	assert.IsType(t, &ValidationError{}, err)
+}
+
+func TestKeyringWithoutKid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.yaml")
+	writeKeyring(t, path, `
+keys:
+  - secret: new-secret
+  - secret: old-secret
+`)
+
+	keyring, err := LoadKeyring(path)
+	assert.NoError(t, err)
+
+	claims := &JWTClaims{Role: "STU", StandardClaims: jwt.StandardClaims{Subject: "kimxwan0319"}}
+	token, err := NewKeyring([]byte("old-secret")).Sign(claims)
+	assert.NoError(t, err)
+
+	_, err = (&Parser{Keys: keyring}).Parse(token)
+	assert.NoError(t, err)
+}
+
+func TestInvalidKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.yaml")
+
+	for _, content := range []string{
+		`keys: []`,
+		`{primary: missing, keys: [{kid: a, secret: s}]}`,
+		`{keys: [{kid: a, secret: s}, {kid: a, secret: t}]}`,
+		`{keys: [{kid: a}]}`,
+	} {
+		writeKeyring(t, path, content)
+		_, err := LoadKeyring(path)
+		assert.Error(t, err, content)
+	}
+}
+
+func TestEmptyKeyring(t *testing.T) {
+	keyring := NewKeyring(nil)
+	assert.True(t, keyring.Empty())
+
+	_, err := keyring.Sign(&JWTClaims{})
+	assert.Error(t, err)
+
+	// A token signed with an empty secret is not verified.
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &JWTClaims{}).SignedString([]byte{})
+	assert.NoError(t, err)
+
+	_, err = (&Parser{Keys: keyring}).Parse(token)
+	assert.Equal(t, "key_not_found", Reason(err))
+}
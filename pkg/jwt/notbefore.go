@@ -0,0 +1,159 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/team-xquare/contour-middleware/pkg/watch"
+)
+
+// NotBeforeStore invalidates every token of a subject issued before a
+// point in time, e.g. after a password change or a forced logout. Like the
+// Denylist, it is read from a YAML file mapping subjects to times
+//
+//	kimxwan0319: 2022-07-01T09:00:00Z
+//
+// and may be updated through Set, which writes to the file so that every
+// replica watching it applies the update. A store without a file keeps the
+// updates in memory. When both hold a time for a subject, the later one
+// applies.
+type NotBeforeStore struct {
+	path string
+
+	mu     sync.RWMutex
+	file   map[string]time.Time
+	pushed map[string]time.Time
+}
+
+func NewNotBeforeStore() *NotBeforeStore {
+	return &NotBeforeStore{file: map[string]time.Time{}, pushed: map[string]time.Time{}}
+}
+
+func LoadNotBeforeStore(path string) (*NotBeforeStore, error) {
+	s := NewNotBeforeStore()
+	s.path = path
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload re-reads the store file.
+func (s *NotBeforeStore) Reload() error {
+	file, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.file = file
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *NotBeforeStore) read() (map[string]time.Time, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := map[string]time.Time{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid not-before store %s: %w", s.path, err)
+	}
+
+	return file, nil
+}
+
+// Watch reloads the store whenever its file changes, until ctx is done.
+func (s *NotBeforeStore) Watch(ctx context.Context, interval time.Duration) {
+	watch.Reload(ctx, interval, "not-before store", s.Reload, s.path)
+}
+
+// Set invalidates the tokens of subject issued before t.
+func (s *NotBeforeStore) Set(subject string, t time.Time) error {
+	if len(subject) == 0 {
+		return errors.New("not-before needs a subject")
+	}
+	if t.IsZero() {
+		return errors.New("not-before needs a time")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.path) == 0 {
+		s.pushed[subject] = t
+		return nil
+	}
+
+	file, err := s.read()
+	if err != nil {
+		return err
+	}
+	if t.After(file[subject]) {
+		file[subject] = t
+	}
+
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(s.path, data); err != nil {
+		return fmt.Errorf("failed to write not-before store %s: %w", s.path, err)
+	}
+	s.file = file
+
+	return nil
+}
+
+// Get returns the time before which tokens of subject are invalid.
+func (s *NotBeforeStore) Get(subject string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.get(subject)
+}
+
+func (s *NotBeforeStore) get(subject string) (time.Time, bool) {
+	t, ok := s.file[subject]
+	if pushed, found := s.pushed[subject]; found && pushed.After(t) {
+		t, ok = pushed, true
+	}
+
+	return t, ok
+}
+
+// List returns the time set for every subject.
+func (s *NotBeforeStore) List() map[string]time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]time.Time, len(s.file)+len(s.pushed))
+	for _, m := range []map[string]time.Time{s.file, s.pushed} {
+		for subject := range m {
+			result[subject], _ = s.get(subject)
+		}
+	}
+
+	return result
+}
+
+// Rejects reports whether claims were issued before the time set for their
+// subject. Tokens without iat are rejected once a time is set.
+func (s *NotBeforeStore) Rejects(claims *JWTClaims) bool {
+	t, ok := s.Get(claims.Subject)
+	if !ok || len(claims.Subject) == 0 {
+		return false
+	}
+
+	return claims.IssuedAt == 0 || claims.IssuedAt < t.Unix()
+}
@@ -0,0 +1,62 @@
+package jwt
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotBeforeStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-before.yaml")
+	writeKeyring(t, path, `
+kimxwan0319: 2022-07-01T09:00:00Z
+`)
+
+	store, err := LoadNotBeforeStore(path)
+	assert.NoError(t, err)
+
+	keyring := NewKeyring([]byte("secret"))
+	parser := &Parser{Keys: keyring, NotBefore: store}
+
+	sign := func(subject string, iat time.Time) string {
+		claims := &JWTClaims{StandardClaims: jwt.StandardClaims{Subject: subject}}
+		if !iat.IsZero() {
+			claims.IssuedAt = iat.Unix()
+		}
+		token, err := keyring.Sign(claims)
+		assert.NoError(t, err)
+		return token
+	}
+
+	cutoff := time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC)
+
+	_, err = parser.Parse(sign("kimxwan0319", cutoff.Add(-time.Second)))
+	assert.Equal(t, "revoked", Reason(err))
+	_, err = parser.Parse(sign("kimxwan0319", time.Time{}))
+	assert.Equal(t, "revoked", Reason(err))
+	_, err = parser.Parse(sign("kimxwan0319", cutoff))
+	assert.NoError(t, err)
+	_, err = parser.Parse(sign("other", time.Time{}))
+	assert.NoError(t, err)
+
+	now := time.Now().Truncate(time.Second)
+	assert.NoError(t, store.Set("kimxwan0319", now))
+	_, err = parser.Parse(sign("kimxwan0319", now.Add(-time.Second)))
+	assert.Equal(t, "revoked", Reason(err))
+
+	// An earlier time does not override the one set before.
+	assert.NoError(t, store.Set("kimxwan0319", cutoff.Add(-time.Hour)))
+	assert.Len(t, store.List(), 1)
+	assert.True(t, now.Equal(store.List()["kimxwan0319"]))
+
+	// Times are written to the file, where other replicas read them.
+	other, err := LoadNotBeforeStore(path)
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(other.List()["kimxwan0319"]))
+
+	assert.Error(t, store.Set("kimxwan0319", time.Time{}))
+	assert.Error(t, store.Set("", now))
+}
@@ -0,0 +1,208 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeySource resolves the keys that may have been used to sign a token.
+// Implementations return only keys that are compatible with the signing
+// method of the token; an empty result means the token cannot be verified.
+type KeySource interface {
+	Keys(token *jwt.Token) ([]interface{}, error)
+}
+
+// KeySources combines several key sources, e.g. a keyring and a JWKS.
+type KeySources []KeySource
+
+func (s KeySources) Keys(token *jwt.Token) ([]interface{}, error) {
+	var keys []interface{}
+	for _, source := range s {
+		k, err := source.Keys(token)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k...)
+	}
+
+	return keys, nil
+}
+
+// DefaultAlgorithms are the signing methods accepted when a Parser does not
+// list its own.
+var DefaultAlgorithms = []string{"HS256", "RS256", "ES256", "EdDSA"}
+
+type Parser struct {
+	Keys KeySource
+
+	// Algorithms lists the accepted signing methods. Tokens signed with
+	// any other method are rejected before a key is looked up.
+	Algorithms []string
+
+	// Expect holds the issuer and audience required by Parse.
+	Expect Expectations
+
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat.
+	Leeway time.Duration
+
+	// Revocations, if set, rejects revoked tokens.
+	Revocations *Denylist
+
+	// NotBefore, if set, rejects tokens issued before the time set for
+	// their subject.
+	NotBefore *NotBeforeStore
+}
+
+// Expectations are the issuer and audience a token must carry. Empty values
+// are not checked.
+type Expectations struct {
+	Issuer   string
+	Audience string
+}
+
+// ValidateAlgorithms reports an error for an empty list, which would reject
+// every token, and for algorithms that are unknown or that do not carry a
+// signature.
+func ValidateAlgorithms(algorithms []string) error {
+	if len(algorithms) == 0 {
+		return errors.New("no signing algorithms")
+	}
+
+	for _, alg := range algorithms {
+		if alg == jwt.SigningMethodNone.Alg() || jwt.GetSigningMethod(alg) == nil {
+			return fmt.Errorf("unsupported signing algorithm %q", alg)
+		}
+	}
+
+	return nil
+}
+
+// Parse verifies the token and validates its claims against p.Expect.
+func (p *Parser) Parse(tokenString string) (*JWTClaims, error) {
+	return p.ParseExpecting(tokenString, p.Expect)
+}
+
+// ParseExpecting verifies the token and validates its claims against expect.
+func (p *Parser) ParseExpecting(tokenString string, expect Expectations) (*JWTClaims, error) {
+	claims, err := p.Verify(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.Validate(claims, expect); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// Verify checks the signature of the token without validating its claims.
+func (p *Parser) Verify(tokenString string) (*JWTClaims, error) {
+	claims := &JWTClaims{}
+
+	token, parts, err := new(jwt.Parser).ParseUnverified(tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.algorithmAllowed(token.Method.Alg()) {
+		return nil, jwt.NewValidationError(
+			fmt.Sprintf("signing method %s is not allowed", token.Method.Alg()),
+			jwt.ValidationErrorSignatureInvalid|ValidationErrorAlgorithmNotAllowed,
+		)
+	}
+
+	keys, err := p.Keys.Keys(token)
+	if err != nil {
+		return nil, &ValidationError{Inner: err, Errors: jwt.ValidationErrorUnverifiable}
+	}
+	if len(keys) == 0 {
+		return nil, jwt.NewValidationError(
+			"no verification key found for token",
+			jwt.ValidationErrorUnverifiable|ValidationErrorKeyNotFound,
+		)
+	}
+
+	signingString := strings.Join(parts[0:2], ".")
+	for _, key := range keys {
+		if err = token.Method.Verify(signingString, parts[2], key); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, &ValidationError{Inner: err, Errors: jwt.ValidationErrorSignatureInvalid}
+	}
+
+	return claims, nil
+}
+
+// Validate checks the time based claims, allowing for p.Leeway, the issuer
+// and audience, and the revocation of already verified claims.
+func (p *Parser) Validate(claims *JWTClaims, expect Expectations) error {
+	now := time.Now().Unix()
+	leeway := int64(p.Leeway / time.Second)
+
+	if !claims.VerifyExpiresAt(now-leeway, false) {
+		return jwt.NewValidationError("token is expired", jwt.ValidationErrorExpired)
+	}
+	if !claims.VerifyNotBefore(now+leeway, false) {
+		return jwt.NewValidationError("token is not valid yet", jwt.ValidationErrorNotValidYet)
+	}
+	if !claims.VerifyIssuedAt(now+leeway, false) {
+		return jwt.NewValidationError("token used before issued", jwt.ValidationErrorIssuedAt)
+	}
+	if len(expect.Issuer) != 0 && claims.Issuer != expect.Issuer {
+		return jwt.NewValidationError(fmt.Sprintf("token issuer %q is not %q", claims.Issuer, expect.Issuer), jwt.ValidationErrorIssuer)
+	}
+	if len(expect.Audience) != 0 && !claims.Audience.Contains(expect.Audience) {
+		return jwt.NewValidationError(fmt.Sprintf("token is not intended for %q", expect.Audience), jwt.ValidationErrorAudience)
+	}
+	if p.Revocations != nil && p.Revocations.Revoked(claims) {
+		return jwt.NewValidationError("token is revoked", jwt.ValidationErrorClaimsInvalid|ValidationErrorRevoked)
+	}
+	if p.NotBefore != nil && p.NotBefore.Rejects(claims) {
+		return jwt.NewValidationError("token was issued before the subject's sessions were invalidated", jwt.ValidationErrorIssuedAt|ValidationErrorRevoked)
+	}
+
+	return nil
+}
+
+func (p *Parser) algorithmAllowed(alg string) bool {
+	algorithms := p.Algorithms
+	if algorithms == nil {
+		algorithms = DefaultAlgorithms
+	}
+
+	for _, a := range algorithms {
+		if a == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+func keyMatchesMethod(key interface{}, method jwt.SigningMethod) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		_, ok := method.(*jwt.SigningMethodECDSA)
+		return ok
+	case ed25519.PublicKey:
+		_, ok := method.(*SigningMethodEdDSA)
+		return ok
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParserRejectsDisallowedAlgorithm(t *testing.T) {
+	keyring := NewKeyring([]byte("secret"))
+	claims := &JWTClaims{Role: "STU", StandardClaims: jwt.StandardClaims{Subject: "kimxwan0319"}}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	_, err = (&Parser{Keys: keyring}).Parse(token)
+	assert.Equal(t, "algorithm_not_allowed", Reason(err))
+
+	_, err = (&Parser{Keys: keyring, Algorithms: []string{"HS512"}}).Parse(token)
+	assert.NoError(t, err)
+}
+
+func TestParserRejectsNoneAlgorithm(t *testing.T) {
+	claims := &JWTClaims{Role: "STU", StandardClaims: jwt.StandardClaims{Subject: "kimxwan0319"}}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.NoError(t, err)
+
+	_, err = (&Parser{Keys: NewKeyring([]byte("secret")), Algorithms: []string{"none"}}).Parse(token)
+	assert.Equal(t, "key_not_found", Reason(err))
+
+	assert.Error(t, ValidateAlgorithms([]string{"HS256", "none"}))
+	assert.Error(t, ValidateAlgorithms([]string{"XS256"}))
+	assert.Error(t, ValidateAlgorithms([]string{}))
+	assert.NoError(t, ValidateAlgorithms(DefaultAlgorithms))
+}
+
+func TestParserReportsUnknownKid(t *testing.T) {
+	claims := &JWTClaims{Role: "STU", StandardClaims: jwt.StandardClaims{Subject: "kimxwan0319"}}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "missing"
+	signed, err := token.SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	keyring := &Keyring{keys: []HMACKey{{Kid: "current", Secret: "secret"}}}
+	_, err = (&Parser{Keys: keyring}).Parse(signed)
+	assert.Equal(t, "key_not_found", Reason(err))
+}
+
+func TestParserValidatesIssuerAndAudience(t *testing.T) {
+	keyring := NewKeyring([]byte("secret"))
+	parser := &Parser{Keys: keyring, Expect: Expectations{Issuer: "xquare", Audience: "feed"}}
+
+	claims := &JWTClaims{Role: "STU", Audience: Audience{"feed", "timetable"}}
+	claims.Subject = "kimxwan0319"
+	claims.Issuer = "xquare"
+	token, err := keyring.Sign(claims)
+	assert.NoError(t, err)
+
+	result, err := parser.Parse(token)
+	assert.NoError(t, err)
+	assert.Equal(t, claims, result)
+
+	_, err = parser.ParseExpecting(token, Expectations{Issuer: "xquare", Audience: "point"})
+	assert.Equal(t, "audience_invalid", Reason(err))
+
+	_, err = parser.ParseExpecting(token, Expectations{Issuer: "other"})
+	assert.Equal(t, "issuer_invalid", Reason(err))
+
+	single, err := keyring.Sign(&JWTClaims{Audience: Audience{"feed"}})
+	assert.NoError(t, err)
+
+	_, err = parser.ParseExpecting(single, Expectations{Audience: "feed"})
+	assert.NoError(t, err)
+}
+
+func TestParserLeeway(t *testing.T) {
+	keyring := NewKeyring([]byte("secret"))
+
+	claims := &JWTClaims{Role: "STU"}
+	claims.ExpiresAt = time.Now().Add(-10 * time.Second).Unix()
+	claims.NotBefore = time.Now().Add(-time.Minute).Unix()
+	token, err := keyring.Sign(claims)
+	assert.NoError(t, err)
+
+	_, err = (&Parser{Keys: keyring}).Parse(token)
+	assert.Equal(t, "expired", Reason(err))
+
+	_, err = (&Parser{Keys: keyring, Leeway: 30 * time.Second}).Parse(token)
+	assert.NoError(t, err)
+
+	claims.ExpiresAt = 0
+	claims.IssuedAt = time.Now().Add(10 * time.Second).Unix()
+	token, err = keyring.Sign(claims)
+	assert.NoError(t, err)
+
+	_, err = (&Parser{Keys: keyring}).Parse(token)
+	assert.Equal(t, "issued_at_invalid", Reason(err))
+
+	_, err = (&Parser{Keys: keyring, Leeway: 30 * time.Second}).Parse(token)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,294 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/team-xquare/contour-middleware/pkg/watch"
+)
+
+// Revocation revokes a single token by its jti, or every token of a subject.
+type Revocation struct {
+	ID      string `yaml:"jti,omitempty"`
+	Subject string `yaml:"subject,omitempty"`
+
+	// ExpiresAt is when the entry may be forgotten, normally the exp of
+	// the revoked token or the longest lifetime of the subject's tokens.
+	// Entries without one are kept until removed from the file.
+	ExpiresAt time.Time `yaml:"expiresAt,omitempty"`
+}
+
+// Validate checks that r revokes either a token id or a subject.
+func (r *Revocation) Validate() error {
+	if (len(r.ID) == 0) == (len(r.Subject) == 0) {
+		return errors.New("revocation needs either a jti or a subject")
+	}
+
+	return nil
+}
+
+func (r *Revocation) expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+type revocations struct {
+	ids      map[string]Revocation
+	subjects map[string]Revocation
+}
+
+func newRevocations() revocations {
+	return revocations{ids: map[string]Revocation{}, subjects: map[string]Revocation{}}
+}
+
+func (r revocations) add(revocation Revocation) {
+	if len(revocation.ID) != 0 {
+		r.ids[revocation.ID] = revocation
+	} else {
+		r.subjects[revocation.Subject] = revocation
+	}
+}
+
+func (r revocations) revoked(claims *JWTClaims, now time.Time) bool {
+	if e, ok := r.ids[claims.Id]; ok && len(claims.Id) != 0 && !e.expired(now) {
+		return true
+	}
+	if e, ok := r.subjects[claims.Subject]; ok && len(claims.Subject) != 0 && !e.expired(now) {
+		return true
+	}
+
+	return false
+}
+
+func (r revocations) prune(now time.Time) int {
+	pruned := 0
+	for _, m := range []map[string]Revocation{r.ids, r.subjects} {
+		for key, e := range m {
+			if e.expired(now) {
+				delete(m, key)
+				pruned++
+			}
+		}
+	}
+
+	return pruned
+}
+
+// list returns the entries that have not expired, token ids first.
+func (r revocations) list(now time.Time) []Revocation {
+	var result []Revocation
+	for _, m := range []map[string]Revocation{r.ids, r.subjects} {
+		for _, e := range m {
+			if !e.expired(now) {
+				result = append(result, e)
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if (len(a.ID) == 0) != (len(b.ID) == 0) {
+			return len(a.ID) != 0
+		}
+		return a.ID+a.Subject < b.ID+b.Subject
+	})
+
+	return result
+}
+
+// Denylist holds revoked token ids and subjects. Entries come from a YAML
+// file, which may be reloaded, and from Revoke, which writes them to the
+// file so that every replica watching it applies them. A Denylist without a
+// file keeps them in memory. Entries are dropped once they expire, as the
+// tokens they revoke are rejected as expired from then on.
+type Denylist struct {
+	path string
+
+	mu     sync.RWMutex
+	file   revocations
+	pushed revocations
+}
+
+func NewDenylist() *Denylist {
+	return &Denylist{file: newRevocations(), pushed: newRevocations()}
+}
+
+// LoadDenylist reads a YAML list of Revocation from path.
+func LoadDenylist(path string) (*Denylist, error) {
+	d := NewDenylist()
+	d.path = path
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Reload re-reads the denylist file.
+func (d *Denylist) Reload() error {
+	file, err := d.read()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.file = file
+	d.mu.Unlock()
+
+	return nil
+}
+
+func (d *Denylist) read() (revocations, error) {
+	data, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return revocations{}, err
+	}
+
+	var entries []Revocation
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return revocations{}, fmt.Errorf("invalid denylist %s: %w", d.path, err)
+	}
+
+	file := newRevocations()
+	for i, e := range entries {
+		if err := e.Validate(); err != nil {
+			return revocations{}, fmt.Errorf("invalid denylist %s: entry #%d: %w", d.path, i, err)
+		}
+		file.add(e)
+	}
+
+	return file, nil
+}
+
+// Watch reloads the denylist whenever its file changes, until ctx is done.
+func (d *Denylist) Watch(ctx context.Context, interval time.Duration) {
+	watch.Reload(ctx, interval, "denylist", d.Reload, d.path)
+}
+
+// Revoke adds r to the denylist, and to its file if it has one. Expired
+// entries are dropped from the file as it is written.
+func (d *Denylist) Revoke(r Revocation) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if r.expired(now) {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.path) == 0 {
+		d.pushed.add(r)
+		return nil
+	}
+
+	file, err := d.read()
+	if err != nil {
+		return err
+	}
+	file.add(r)
+	file.prune(now)
+
+	data, err := yaml.Marshal(file.list(now))
+	if err != nil {
+		return err
+	}
+	if err := writeFile(d.path, data); err != nil {
+		return fmt.Errorf("failed to write denylist %s: %w", d.path, err)
+	}
+	d.file = file
+
+	return nil
+}
+
+// Revoked reports whether the token id or the subject of claims is revoked.
+func (d *Denylist) Revoked(claims *JWTClaims) bool {
+	now := time.Now()
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.file.revoked(claims, now) || d.pushed.revoked(claims, now)
+}
+
+// List returns the entries that have not expired, token ids first.
+func (d *Denylist) List() []Revocation {
+	now := time.Now()
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	all := newRevocations()
+	for _, r := range []revocations{d.file, d.pushed} {
+		for _, m := range []map[string]Revocation{r.ids, r.subjects} {
+			for _, e := range m {
+				all.add(e)
+			}
+		}
+	}
+
+	return all.list(now)
+}
+
+// Prune drops expired entries and returns how many were dropped.
+func (d *Denylist) Prune() int {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.file.prune(now) + d.pushed.prune(now)
+}
+
+// Run prunes the denylist every interval until ctx is done.
+func (d *Denylist) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := d.Prune(); n != 0 {
+				logrus.Infof("pruned %d expired denylist entries", n)
+			}
+		}
+	}
+}
+
+// writeFile replaces the file at path with data, through a rename so that
+// replicas watching it never read it half written.
+func writeFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(f.Name(), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(f.Name(), path)
+}
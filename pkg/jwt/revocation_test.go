@@ -0,0 +1,72 @@
+package jwt
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDenylist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.yaml")
+	writeKeyring(t, path, `
+- jti: leaked
+- subject: suspended
+  expiresAt: 2000-01-01T00:00:00Z
+`)
+
+	denylist, err := LoadDenylist(path)
+	assert.NoError(t, err)
+
+	keyring := NewKeyring([]byte("secret"))
+	parser := &Parser{Keys: keyring, Revocations: denylist}
+
+	sign := func(id string, subject string) string {
+		token, err := keyring.Sign(&JWTClaims{StandardClaims: jwt.StandardClaims{Id: id, Subject: subject}})
+		assert.NoError(t, err)
+		return token
+	}
+
+	_, err = parser.Parse(sign("leaked", "kimxwan0319"))
+	assert.Equal(t, "revoked", Reason(err))
+
+	// The subject entry has expired.
+	_, err = parser.Parse(sign("1", "suspended"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, denylist.Revoke(Revocation{Subject: "suspended", ExpiresAt: time.Now().Add(time.Hour)}))
+	_, err = parser.Parse(sign("1", "suspended"))
+	assert.Equal(t, "revoked", Reason(err))
+
+	assert.Error(t, denylist.Revoke(Revocation{ID: "1", Subject: "suspended"}))
+	assert.Error(t, denylist.Revoke(Revocation{}))
+
+	assert.Equal(t, []Revocation{
+		{ID: "leaked"},
+		{Subject: "suspended", ExpiresAt: denylist.List()[1].ExpiresAt},
+	}, denylist.List())
+
+	// Revocations are written to the file, where other replicas read them,
+	// and expired entries are dropped from it.
+	other, err := LoadDenylist(path)
+	assert.NoError(t, err)
+	assert.Len(t, other.List(), 2)
+	assert.Equal(t, "leaked", other.List()[0].ID)
+	assert.True(t, denylist.List()[1].ExpiresAt.Equal(other.List()[1].ExpiresAt))
+	assert.Equal(t, 0, other.Prune())
+
+	writeKeyring(t, path, `[]`)
+	assert.NoError(t, denylist.Reload())
+
+	_, err = parser.Parse(sign("1", "suspended"))
+	assert.NoError(t, err)
+}
+
+func TestDenylistInMemory(t *testing.T) {
+	denylist := NewDenylist()
+	assert.NoError(t, denylist.Revoke(Revocation{ID: "leaked"}))
+	assert.NoError(t, denylist.Revoke(Revocation{ID: "expired", ExpiresAt: time.Now().Add(-time.Second)}))
+	assert.Equal(t, []Revocation{{ID: "leaked"}}, denylist.List())
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "contour_auth"
+
+var (
+	// CheckDuration observes the time taken by Check calls, by API version.
+	CheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "check_duration_seconds",
+		Help:      "Time taken to decide on a check request.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"api"})
+
+	// CheckDecisions counts Check decisions by API version, outcome,
+	// status code and denial reason.
+	CheckDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "check_decisions_total",
+		Help:      "Check decisions by API version, outcome, status code and denial reason.",
+	}, []string{"api", "decision", "status", "reason"})
+
+	// TokenValidationFailures counts rejected tokens by jwt.Reason.
+	TokenValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_validation_failures_total",
+		Help:      "Rejected tokens by validation failure reason.",
+	}, []string{"reason"})
+
+	// TokenCacheLookups counts lookups of the verified token cache by
+	// result, either hit or miss.
+	TokenCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_cache_lookups_total",
+		Help:      "Lookups of the verified token cache by result.",
+	}, []string{"result"})
+
+	serverHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "RPCs completed on the server, regardless of success or failure.",
+	}, []string{"grpc_service", "grpc_method", "grpc_code"})
+
+	serverHandlingSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Time taken by the server to handle RPCs.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_service", "grpc_method"})
+
+	serverInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "grpc_server_in_flight",
+		Help: "RPCs currently being handled by the server.",
+	}, []string{"grpc_service", "grpc_method"})
+)
+
+// Registry holds the metrics of the authorization server along with the Go
+// runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		CheckDuration,
+		CheckDecisions,
+		TokenValidationFailures,
+		TokenCacheLookups,
+		serverHandled,
+		serverHandlingSeconds,
+		serverInFlight,
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus exposition
+// format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// UnaryServerInterceptor records the gRPC server metrics of unary calls.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		service, method := splitMethodName(info.FullMethod)
+
+		serverInFlight.WithLabelValues(service, method).Inc()
+		defer serverInFlight.WithLabelValues(service, method).Dec()
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		serverHandlingSeconds.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+		serverHandled.WithLabelValues(service, method, status.Code(err).String()).Inc()
+
+		return resp, err
+	}
+}
+
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+
+	return "unknown", "unknown"
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/envoy.service.auth.v3.Authorization/Check"}
+	ok := serverHandled.WithLabelValues("envoy.service.auth.v3.Authorization", "Check", "OK")
+	unavailable := serverHandled.WithLabelValues("envoy.service.auth.v3.Authorization", "Check", "Unavailable")
+	okBefore, unavailableBefore := testutil.ToFloat64(ok), testutil.ToFloat64(unavailable)
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	assert.NoError(t, err)
+
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	})
+	assert.Error(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(ok)-okBefore)
+	assert.Equal(t, 1.0, testutil.ToFloat64(unavailable)-unavailableBefore)
+	assert.Equal(t, 0.0, testutil.ToFloat64(serverInFlight.WithLabelValues("envoy.service.auth.v3.Authorization", "Check")))
+}
+
+func TestSplitMethodName(t *testing.T) {
+	service, method := splitMethodName("/grpc.health.v1.Health/Check")
+	assert.Equal(t, "grpc.health.v1.Health", service)
+	assert.Equal(t, "Check", method)
+
+	service, method = splitMethodName("invalid")
+	assert.Equal(t, "unknown", service)
+	assert.Equal(t, "unknown", method)
+}
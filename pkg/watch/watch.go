@@ -0,0 +1,68 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Files calls fn whenever the content of any of the given paths changes,
+// until ctx is done. The files are polled rather than watched through
+// inotify so that the symlink swaps Kubernetes performs when updating
+// mounted secrets and config maps are noticed as well.
+func Files(ctx context.Context, interval time.Duration, fn func(), paths ...string) {
+	last := digest(paths)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := digest(paths)
+			if current == nil || bytes.Equal(current, last) {
+				continue
+			}
+
+			last = current
+			fn()
+		}
+	}
+}
+
+// Reload calls reload whenever the content of any of the given paths
+// changes, until ctx is done, and logs the outcome for the file described by
+// name. A failed reload is only logged, so the state loaded last is kept
+// while the files are invalid, e.g. in the middle of an update.
+func Reload(ctx context.Context, interval time.Duration, name string, reload func() error, paths ...string) {
+	Files(ctx, interval, func() {
+		if err := reload(); err != nil {
+			logrus.WithError(err).Warnf("failed to reload %s", name)
+			return
+		}
+		logrus.Infof("reloaded %s from %s", name, paths[0])
+	}, paths...)
+}
+
+// digest hashes the content of every path, or returns nil when any of them
+// cannot be read, e.g. in the middle of an update.
+func digest(paths []string) []byte {
+	h := sha256.New()
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+
+	return h.Sum(nil)
+}
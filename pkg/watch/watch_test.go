@@ -0,0 +1,72 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v1"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	go Files(ctx, 10*time.Millisecond, func() { changed <- struct{}{} }, path)
+
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case <-changed:
+		t.Fatal("unexpected change notification")
+	default:
+	}
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v2"), 0600))
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("change was not noticed")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v1"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan string, 1)
+	go Reload(ctx, 10*time.Millisecond, "file", func() error {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// Only v2 is valid; the file may also be read half written.
+		if string(data) != "v2" {
+			return errors.New("invalid file")
+		}
+		reloaded <- string(data)
+		return nil
+	}, path)
+
+	for _, content := range []string{"invalid", "v2"} {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	select {
+	case content := <-reloaded:
+		assert.Equal(t, "v2", content)
+	case <-time.After(time.Second):
+		t.Fatal("change was not reloaded")
+	}
+}